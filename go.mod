@@ -3,9 +3,11 @@ module github.com/team4yf/fpm-go-plugin-orm
 go 1.14
 
 require (
+	github.com/jackc/pgconn v1.6.4
+	github.com/prometheus/client_golang v1.7.1
 	github.com/stretchr/testify v1.7.0
 	github.com/team4yf/fpm-go-pkg v0.0.0-20201029024727-40ba3189a192
-	github.com/team4yf/yf-fpm-server-go v1.0.7 // indirect
+	github.com/team4yf/yf-fpm-server-go v1.0.7
 	golang.org/x/sys v0.0.0-20200909081042-eff7692f9009 // indirect
 	gopkg.in/ini.v1 v1.61.0 // indirect
 	gorm.io/driver/postgres v1.0.0
@@ -0,0 +1,163 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	aggregateFuncs = map[string]string{
+		"count":         "count(%s)",
+		"countdistinct": "count(distinct %s)",
+		"sum":           "sum(%s)",
+		"avg":           "avg(%s)",
+		"min":           "min(%s)",
+		"max":           "max(%s)",
+	}
+
+	havingOperators = map[string]bool{
+		"=": true, "!=": true, "<>": true, ">": true, ">=": true, "<": true, "<=": true,
+	}
+
+	errHavingWithoutGroupBy = Invalidf("INVALID_HAVING: group by required")
+)
+
+//Aggregate the aggregate function on the field, the result is named by the alias
+type Aggregate struct {
+	Func  string
+	Field string
+	Alias string
+}
+
+//Having the condition on the aggregate of the alias
+type Having struct {
+	Alias    string
+	Operator string
+	Value    interface{}
+}
+
+//AggregateQuery the grouped query, the Condition, Sorter and Pager of the QueryData are applied,
+//the Sorter could use the aliases of the aggregates
+type AggregateQuery struct {
+	*db.QueryData
+	GroupBy    []string
+	Aggregates []Aggregate
+	Having     []Having
+}
+
+//NewAggregateQuery create a aggregate query
+func NewAggregateQuery() *AggregateQuery {
+	return &AggregateQuery{
+		QueryData:  db.NewQuery(),
+		GroupBy:    make([]string, 0),
+		Aggregates: make([]Aggregate, 0),
+		Having:     make([]Having, 0),
+	}
+}
+
+//Aggregator run the aggregate queries
+type Aggregator interface {
+	Aggregate(q *AggregateQuery, result *[]map[string]interface{}) error
+
+	AggregateContext(ctx context.Context, q *AggregateQuery, result *[]map[string]interface{}) error
+}
+
+//expression build the sql of the aggregate, count(*) is allowed
+func (a Aggregate) expression() (string, error) {
+	format, ok := aggregateFuncs[strings.ToLower(a.Func)]
+	if !ok {
+		return "", Invalidf("INVALID_AGGREGATE: %s", a.Func)
+	}
+	field := a.Field
+	if field == "" || field == "*" {
+		if format != aggregateFuncs["count"] {
+			return "", Invalidf("INVALID_AGGREGATE: %s(*)", a.Func)
+		}
+		field = "*"
+	} else if !IsColumn(field) {
+		return "", Invalidf("INVALID_AGGREGATE: %s", a.Field)
+	}
+	return fmt.Sprintf(format, field), nil
+}
+
+//OK
+//Ex:
+// q := plugins.NewAggregateQuery()
+// q.SetTable("fake")
+// q.GroupBy = []string{"name"}
+// q.Aggregates = []plugins.Aggregate{{Func: "sum", Field: "value", Alias: "total"}}
+// q.AddSorter(db.Sorter{Sortby: "total", Asc: "desc"})
+// err = dbclient.(plugins.Aggregator).Aggregate(q, &list)
+func (p *ormImpl) Aggregate(q *AggregateQuery, result *[]map[string]interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("aggregate", q.Table, begin, err) }(time.Now())
+	query, err := p.aggregateQuery(q)
+	if err != nil {
+		return
+	}
+	return p.eachQuery(query, func(m map[string]interface{}) error {
+		*result = append(*result, m)
+		return nil
+	})
+}
+
+func (p *ormImpl) AggregateContext(ctx context.Context, q *AggregateQuery, result *[]map[string]interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Aggregate(q, result)
+}
+
+func (p *ormImpl) aggregateQuery(q *AggregateQuery) (query *gorm.DB, err error) {
+	if len(q.Aggregates) == 0 {
+		return nil, Invalidf("INVALID_AGGREGATE: no aggregates")
+	}
+	selects := make([]string, 0, len(q.GroupBy)+len(q.Aggregates))
+	for _, g := range q.GroupBy {
+		if !IsColumn(g) {
+			return nil, Invalidf("INVALID_GROUP_BY: %s", g)
+		}
+		selects = append(selects, g)
+	}
+	expressions := make(map[string]string)
+	for _, a := range q.Aggregates {
+		var expr string
+		if expr, err = a.expression(); err != nil {
+			return
+		}
+		if !IsColumn(a.Alias) {
+			return nil, Invalidf("INVALID_AGGREGATE: alias %s", a.Alias)
+		}
+		expressions[a.Alias] = expr
+		selects = append(selects, expr+" as "+a.Alias)
+	}
+	query = p.db.Table(q.Table).Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...).
+		Select(strings.Join(selects, ","))
+	if len(q.GroupBy) > 0 {
+		query = query.Clauses(clause.GroupBy{
+			Columns: []clause.Column{{Name: strings.Join(q.GroupBy, ","), Raw: true}},
+		})
+	}
+	for _, h := range q.Having {
+		if len(q.GroupBy) == 0 {
+			return nil, errHavingWithoutGroupBy
+		}
+		expr, ok := expressions[h.Alias]
+		if !ok {
+			return nil, Invalidf("INVALID_HAVING: %s", h.Alias)
+		}
+		if !havingOperators[h.Operator] {
+			return nil, Invalidf("INVALID_HAVING: %s", h.Operator)
+		}
+		query = query.Having(expr+" "+h.Operator+" ?", h.Value)
+	}
+	for _, sort := range q.Sorter {
+		query = query.Order(sort.Sortby + " " + sort.Asc)
+	}
+	query = query.Offset(q.Pager.Skip).Limit(q.Pager.Limit)
+	return
+}
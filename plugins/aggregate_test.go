@@ -0,0 +1,47 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+//dryRunImpl create a impl which builds the sql without the connection
+func dryRunImpl(t *testing.T) *ormImpl {
+	d, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	assert.Nil(t, err, "should nil err")
+	return &ormImpl{db: d}
+}
+
+func TestAggregateQuery(t *testing.T) {
+	q := NewAggregateQuery()
+	q.SetTable("fake").SetCondition("value > ?", 1)
+	q.GroupBy = []string{"name"}
+	q.Aggregates = []Aggregate{
+		{Func: "count", Alias: "total"},
+		{Func: "countDistinct", Field: "value", Alias: "kinds"},
+	}
+	q.Having = []Having{{Alias: "total", Operator: ">", Value: 2}}
+	q.AddSorter(db.Sorter{Sortby: "total", Asc: "desc"})
+
+	query, err := dryRunImpl(t).aggregateQuery(q)
+	assert.Nil(t, err, "should nil err")
+	list := make([]map[string]interface{}, 0)
+	stmt := query.Find(&list).Statement
+	assert.Equal(t, `SELECT name,count(*) as total,count(distinct value) as kinds FROM "fake" WHERE (value > $1) and deleted_at is null GROUP BY name HAVING count(*) > $2 ORDER BY total desc`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	q.Aggregates = []Aggregate{{Func: "sum", Alias: "total"}}
+	_, err = dryRunImpl(t).aggregateQuery(q)
+	assert.NotNil(t, err, "sum(*) should err")
+
+	q.Aggregates = []Aggregate{{Func: "sum", Field: "value; drop table fake", Alias: "total"}}
+	_, err = dryRunImpl(t).aggregateQuery(q)
+	assert.NotNil(t, err, "should err")
+}
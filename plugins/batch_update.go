@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//RowChanges the changes of the row of the id
+type RowChanges struct {
+	ID      interface{}
+	Changes db.CommonMap
+}
+
+//RowResult the affected rows of the id, 0 if the row not found
+type RowResult struct {
+	ID   interface{} `json:"id"`
+	Rows int64       `json:"rows"`
+}
+
+//BatchUpdater update the rows with the different changes
+type BatchUpdater interface {
+	//BatchUpdate update the rows in a transaction, all or nothing,
+	//the Condition of the q is applied to all the rows
+	BatchUpdate(q *db.BaseData, list []RowChanges, results *[]RowResult) error
+
+	BatchUpdateContext(ctx context.Context, q *db.BaseData, list []RowChanges, results *[]RowResult) error
+}
+
+//OK
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake")
+// err = dbclient.(plugins.BatchUpdater).BatchUpdate(q.BaseData, []plugins.RowChanges{
+// 	{ID: 1, Changes: db.CommonMap{"value": 101}},
+// 	{ID: 2, Changes: db.CommonMap{"value": 102, "name": "b"}},
+// }, &results)
+func (p *ormImpl) BatchUpdate(q *db.BaseData, list []RowChanges, results *[]RowResult) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("batchUpdate", q.Table, begin, err) }(time.Now())
+	for _, one := range list {
+		if one.ID == nil || len(one.Changes) == 0 {
+			return Invalidf("INVALID_BATCH_UPDATE: id and changes required")
+		}
+	}
+	updated := make([]RowResult, 0, len(list))
+	now := time.Now()
+	// the savepoint in a transaction, retried on the serialization failures
+	if err = p.TransactionWith(TxOptions{}, func(tx db.Database) error {
+		d := tx.(*ormTx).db
+		updated = updated[:0]
+		for _, one := range list {
+			keyArr, params, err := p.updateSets(q.Table, one.Changes, now)
+			if err != nil {
+				return err
+			}
+			sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s and id = ?", q.Table, strings.Join(keyArr, ","),
+				p.scoped(q.Table, q.Condition, "deleted_at"))
+			params = append(params, q.Arguments...)
+			result := d.Exec(sql, append(params, normalizeValue(one.ID))...)
+			if result.Error != nil {
+				return result.Error
+			}
+			updated = append(updated, RowResult{ID: one.ID, Rows: result.RowsAffected})
+		}
+		return nil
+	}); err != nil {
+		return
+	}
+	*results = append(*results, updated...)
+	return
+}
+
+func (p *ormImpl) BatchUpdateContext(ctx context.Context, q *db.BaseData, list []RowChanges, results *[]RowResult) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.BatchUpdate(q, list, results)
+}
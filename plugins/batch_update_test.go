@@ -0,0 +1,20 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestBatchUpdateInvalid(t *testing.T) {
+	q := db.NewQuery()
+	q.SetTable("fake")
+	results := make([]RowResult, 0)
+	err := dryRunImpl(t).BatchUpdate(q.BaseData, []RowChanges{
+		{ID: 1, Changes: db.CommonMap{"value": 101}},
+		{ID: 2},
+	}, &results)
+	assert.NotNil(t, err, "should err without the changes")
+	assert.Equal(t, 0, len(results), "")
+}
@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"context"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//ContextDatabase the database which runs the queries with the context,
+//the query is cancelled when the ctx is done or the default timeout reached
+type ContextDatabase interface {
+	db.Database
+
+	WithContext(ctx context.Context) db.Database
+
+	FindContext(ctx context.Context, q *db.QueryData, result interface{}) error
+
+	CountContext(ctx context.Context, q *db.BaseData, total *int64) error
+
+	FindAndCountContext(ctx context.Context, q *db.QueryData, result interface{}, total *int64) error
+
+	FirstContext(ctx context.Context, q *db.QueryData, result interface{}) error
+
+	CreateContext(ctx context.Context, q *db.BaseData, entity interface{}) error
+
+	RemoveContext(ctx context.Context, q *db.BaseData, total *int64) error
+
+	UpdatesContext(ctx context.Context, q *db.BaseData, updates db.CommonMap, rows *int64) error
+
+	ExecuteContext(ctx context.Context, sql string, rows *int64) error
+
+	RawContext(ctx context.Context, sql string, result interface{}) error
+
+	RawsContext(ctx context.Context, sql string, iterator func() interface{}, appender func(interface{})) error
+
+	TransactionContext(ctx context.Context, body func(db.Database) error) error
+}
+
+//WithContext run the queries with the ctx, the tracer gets it as the parent
+func (p *ormImpl) WithContext(ctx context.Context) db.Database {
+	return p.session(p.db.WithContext(ctx))
+}
+
+//withTimeout bind the ctx to a new impl, the default timeout is applied if the ctx has no deadline
+func (p *ormImpl) withTimeout(ctx context.Context) (*ormImpl, context.CancelFunc) {
+	cancel := func() {}
+	if _, ok := ctx.Deadline(); !ok && p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+	}
+	return p.session(p.db.WithContext(ctx)), cancel
+}
+
+func (p *ormImpl) FindContext(ctx context.Context, q *db.QueryData, result interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Find(q, result)
+}
+
+func (p *ormImpl) CountContext(ctx context.Context, q *db.BaseData, total *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Count(q, total)
+}
+
+func (p *ormImpl) FindAndCountContext(ctx context.Context, q *db.QueryData, result interface{}, total *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.FindAndCount(q, result, total)
+}
+
+func (p *ormImpl) FirstContext(ctx context.Context, q *db.QueryData, result interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.First(q, result)
+}
+
+func (p *ormImpl) CreateContext(ctx context.Context, q *db.BaseData, entity interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Create(q, entity)
+}
+
+func (p *ormImpl) RemoveContext(ctx context.Context, q *db.BaseData, total *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Remove(q, total)
+}
+
+func (p *ormImpl) UpdatesContext(ctx context.Context, q *db.BaseData, updates db.CommonMap, rows *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Updates(q, updates, rows)
+}
+
+func (p *ormImpl) ExecuteContext(ctx context.Context, sql string, rows *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Execute(sql, rows)
+}
+
+func (p *ormImpl) RawContext(ctx context.Context, sql string, result interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Raw(sql, result)
+}
+
+func (p *ormImpl) RawsContext(ctx context.Context, sql string, iterator func() interface{}, appender func(interface{})) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Raws(sql, iterator, appender)
+}
+
+//TransactionContext the default timeout bounds the whole transaction
+func (p *ormImpl) TransactionContext(ctx context.Context, body func(db.Database) error) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Transaction(body)
+}
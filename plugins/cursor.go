@@ -0,0 +1,212 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+var errInvalidCursor = Invalidf("INVALID_CURSOR")
+
+//CursorFinder find the pages by the keyset, the cursor is built from the scanned values before the time format,
+//so the time columns could be sorted by with any TimeFormat
+type CursorFinder interface {
+	//FindCursor find the page after the cursor, the next is empty on the last page
+	FindCursor(q *db.QueryData, cursor string, result *[]map[string]interface{}, next *string) error
+
+	FindCursorContext(ctx context.Context, q *db.QueryData, cursor string, result *[]map[string]interface{}, next *string) error
+}
+
+//ApplyCursor turn the query into a keyset pagination on the sorters.
+//The id is appended as the tie-breaker, the rows after the cursor are matched,
+//the cursor should be empty for the first page.
+//The null values are placed by the nulls first or last of the sorter, the default of the db:
+//last for the asc, first for the desc.
+func ApplyCursor(q *db.QueryData, cursor string) (err error) {
+	hasID := false
+	for _, s := range q.Sorter {
+		if !IsColumn(s.Sortby) {
+			return Invalidf("INVALID_SORT: %s", s.Sortby)
+		}
+		if s.Sortby == "id" {
+			hasID = true
+		}
+	}
+	if !hasID {
+		q.AddSorter(db.Sorter{
+			Sortby: "id",
+			Asc:    "asc",
+		})
+	}
+	if len(q.Fields) > 0 {
+		for _, s := range q.Sorter {
+			if !containsString(q.Fields, s.Sortby) {
+				q.AddFields(s.Sortby)
+			}
+		}
+	}
+	q.Pager.Skip = 0
+	if cursor == "" {
+		return
+	}
+
+	values, err := decodeCursor(cursor)
+	if err != nil {
+		return
+	}
+	if len(values) != len(q.Sorter) {
+		return errInvalidCursor
+	}
+	// (a > ?) or (a = ? and b > ?) or ..., the null follows the nulls ordering
+	ors := make([]string, 0, len(q.Sorter))
+	args := make([]interface{}, 0)
+	args = append(args, q.Arguments...)
+	for i, s := range q.Sorter {
+		desc, nullsFirst := sortOrder(s.Asc)
+		after := ""
+		switch {
+		case values[i] == nil && !nullsFirst:
+			// nothing after the null of the nulls last
+			continue
+		case values[i] == nil:
+			after = s.Sortby + " is not null"
+		case desc:
+			after = s.Sortby + " < ?"
+		default:
+			after = s.Sortby + " > ?"
+		}
+		if values[i] != nil && !nullsFirst && s.Sortby != "id" {
+			// the nulls after the values
+			after = "(" + after + " or " + s.Sortby + " is null)"
+		}
+		ands := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				ands = append(ands, q.Sorter[j].Sortby+" is null")
+				continue
+			}
+			ands = append(ands, q.Sorter[j].Sortby+" = ?")
+			args = append(args, values[j])
+		}
+		ands = append(ands, after)
+		if values[i] != nil {
+			args = append(args, values[i])
+		}
+		ors = append(ors, "("+strings.Join(ands, " and ")+")")
+	}
+	if len(ors) == 0 {
+		// the null id of the forged cursor
+		return errInvalidCursor
+	}
+	q.SetCondition(fmt.Sprintf("(%s) and (%s)", q.Condition, strings.Join(ors, " or ")), args...)
+	return
+}
+
+//NextCursor create the cursor of the page after the row, the row is the last one of the current page
+func NextCursor(q *db.QueryData, row map[string]interface{}) (cursor string, err error) {
+	values := make([]interface{}, len(q.Sorter))
+	for i, s := range q.Sorter {
+		v, ok := row[s.Sortby]
+		if !ok {
+			return "", Invalidf("INVALID_CURSOR: column %s not selected", s.Sortby)
+		}
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		values[i] = v
+	}
+	raw, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+//OK
+//Ex:
+// q := db.NewQuery()
+// q.AddSorter(db.Sorter{Sortby: "created_at", Asc: "desc"}).SetPager(&db.Pagination{Limit: 20}).SetTable("fake")
+// err = dbclient.(plugins.CursorFinder).FindCursor(q, cursor, &list, &next)
+func (p *ormImpl) FindCursor(q *db.QueryData, cursor string, result *[]map[string]interface{}, next *string) (err error) {
+	if err = ApplyCursor(q, cursor); err != nil {
+		return
+	}
+	raw := p.session(p.db)
+	raw.timeFormat = ""
+	list := make([]map[string]interface{}, 0)
+	if err = raw.Find(q, &list); err != nil {
+		return
+	}
+	if *next, err = pageCursor(q, list); err != nil {
+		return
+	}
+	*result = append(*result, formatTimes(list, p.timeFormat)...)
+	return
+}
+
+func (p *ormImpl) FindCursorContext(ctx context.Context, q *db.QueryData, cursor string, result *[]map[string]interface{}, next *string) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.FindCursor(q, cursor, result, next)
+}
+
+//pageCursor the cursor after the last row if the page is full, empty for the last page
+func pageCursor(q *db.QueryData, list []map[string]interface{}) (string, error) {
+	if q.Pager.Limit <= 0 || len(list) < q.Pager.Limit {
+		return "", nil
+	}
+	return NextCursor(q, list[len(list)-1])
+}
+
+func decodeCursor(cursor string) (values []interface{}, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	// keep the bigint ids exact
+	decoder.UseNumber()
+	if err = decoder.Decode(&values); err != nil {
+		return nil, errInvalidCursor
+	}
+	for i, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		if values[i], err = n.Int64(); err == nil {
+			continue
+		}
+		if values[i], err = n.Float64(); err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	return
+}
+
+//sortOrder the direction and the nulls ordering of the asc like "desc nulls last"
+func sortOrder(asc string) (desc, nullsFirst bool) {
+	asc = strings.ToLower(asc)
+	desc = strings.HasPrefix(strings.TrimSpace(asc), "desc")
+	switch {
+	case strings.Contains(asc, "nulls first"):
+		return desc, true
+	case strings.Contains(asc, "nulls last"):
+		return desc, false
+	}
+	return desc, desc
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestCursor(t *testing.T) {
+	q := db.NewQuery()
+	q.AddSorter(db.Sorter{
+		Sortby: "value",
+		Asc:    "desc",
+	}).SetTable("fake").SetCondition("name = ?", "c")
+	err := ApplyCursor(q, "")
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, 2, len(q.Sorter), "should append the id")
+	assert.Equal(t, "name = ?", q.Condition, "")
+
+	cursor, err := NextCursor(q, map[string]interface{}{
+		"id":    int64(7),
+		"name":  "c",
+		"value": []byte("100"),
+	})
+	assert.Nil(t, err, "should nil err")
+
+	q = db.NewQuery()
+	q.AddSorter(db.Sorter{
+		Sortby: "value",
+		Asc:    "desc",
+	}).SetTable("fake").SetCondition("name = ?", "c")
+	err = ApplyCursor(q, cursor)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "(name = ?) and ((value < ?) or (value = ? and id > ?))", q.Condition, "")
+	assert.Equal(t, []interface{}{"c", "100", "100", int64(7)}, q.Arguments, "")
+
+	// the bigint id above 2^53
+	cursor, err = NextCursor(q, map[string]interface{}{
+		"id":    int64(1<<60 + 1),
+		"value": 10.5,
+	})
+	assert.Nil(t, err, "should nil err")
+	values, err := decodeCursor(cursor)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, []interface{}{10.5, int64(1<<60 + 1)}, values, "should be exact")
+
+	err = ApplyCursor(db.NewQuery(), "bad")
+	assert.NotNil(t, err, "should err")
+}
+
+func TestCursorNull(t *testing.T) {
+	query := func(asc string, value interface{}) *db.QueryData {
+		q := db.NewQuery()
+		q.AddSorter(db.Sorter{Sortby: "value", Asc: asc}).SetTable("fake").SetCondition("1 = 1")
+		cursor, err := NextCursor(&db.QueryData{Sorter: append(q.Sorter, db.Sorter{Sortby: "id", Asc: "asc"})},
+			map[string]interface{}{"id": int64(7), "value": value})
+		assert.Nil(t, err, "should nil err")
+		assert.Nil(t, ApplyCursor(q, cursor), "should nil err")
+		return q
+	}
+
+	// the nulls last of the asc by default
+	q := query("asc", nil)
+	assert.Equal(t, "(1 = 1) and ((value is null and id > ?))", q.Condition, "only the nulls after the null")
+	assert.Equal(t, []interface{}{int64(7)}, q.Arguments, "")
+	q = query("asc", int64(3))
+	assert.Equal(t, "(1 = 1) and (((value > ? or value is null)) or (value = ? and id > ?))", q.Condition, "the nulls after the values")
+	assert.Equal(t, []interface{}{int64(3), int64(3), int64(7)}, q.Arguments, "")
+
+	// the nulls first of the desc by default
+	q = query("desc", nil)
+	assert.Equal(t, "(1 = 1) and ((value is not null) or (value is null and id > ?))", q.Condition, "the values after the nulls")
+	assert.Equal(t, []interface{}{int64(7)}, q.Arguments, "")
+	q = query("desc nulls last", int64(3))
+	assert.Equal(t, "(1 = 1) and (((value < ? or value is null)) or (value = ? and id > ?))", q.Condition, "")
+	q = query("asc nulls first", nil)
+	assert.Equal(t, "(1 = 1) and ((value is not null) or (value is null and id > ?))", q.Condition, "")
+}
+
+func TestCursorTimeFormat(t *testing.T) {
+	begin := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < 7; i++ {
+		// the rows in the same millisecond, the last two at the same time
+		at := begin.Add(time.Duration(i) * 300 * time.Microsecond)
+		if i == 6 {
+			at = begin.Add(5 * 300 * time.Microsecond)
+		}
+		rows = append(rows, map[string]interface{}{"id": int64(i + 1), "created_at": at})
+	}
+	// match the rows after the (created_at, id) of the cursor, like the db does
+	page := func(q *db.QueryData) []map[string]interface{} {
+		list := make([]map[string]interface{}, 0)
+		for _, row := range rows {
+			if len(q.Arguments) > 0 {
+				after, err := time.Parse(time.RFC3339Nano, q.Arguments[0].(string))
+				assert.Nil(t, err, "the cursor should keep the raw time")
+				at := row["created_at"].(time.Time)
+				if !at.After(after) && !(at.Equal(after) && row["id"].(int64) > q.Arguments[2].(int64)) {
+					continue
+				}
+			}
+			if len(list) < q.Pager.Limit {
+				list = append(list, map[string]interface{}{"id": row["id"], "created_at": row["created_at"]})
+			}
+		}
+		return list
+	}
+
+	seen := make([]interface{}, 0)
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		q := db.NewQuery()
+		q.AddSorter(db.Sorter{Sortby: "created_at", Asc: "asc"}).SetPager(&db.Pagination{Limit: 2}).SetTable("fake")
+		err := ApplyCursor(q, cursor)
+		assert.Nil(t, err, "should nil err")
+		list := page(q)
+		if cursor, err = pageCursor(q, list); err != nil {
+			t.Fatal(err)
+		}
+		for _, row := range formatTimes(list, TimeFormatEpoch) {
+			assert.IsType(t, int64(0), row["created_at"], "should be the epoch millis")
+			seen = append(seen, row["id"])
+		}
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7)}, seen, "should visit every row once")
+}
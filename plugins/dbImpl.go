@@ -1,10 +1,9 @@
 package plugins
 
 import (
-	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	stdlog "log"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -14,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/team4yf/fpm-go-pkg/log"
 	"github.com/team4yf/yf-fpm-server-go/pkg/db"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -36,6 +36,39 @@ type DBSetting struct {
 	Charset  string
 	ShowSQL  bool
 	Dsn      string
+	// LogLevel silent, error, warn, info; follows ShowSQL when empty
+	LogLevel string
+	// SlowThreshold the slow sql threshold in milliseconds, default 1000
+	SlowThreshold int
+	// RedactParams hide the literal values of the sql in the logs
+	RedactParams bool
+	// Timeout the default timeout of the context queries in milliseconds, 0 means no timeout
+	Timeout int
+	// TimeFormat the format of the time columns in the map results,
+	// empty keeps the time.Time, epoch for the epoch millis, or a layout like 2006-01-02 15:04:05
+	TimeFormat string
+	// Naming the naming strategy of the keys of the common biz, empty for the column names, camel for camelCase
+	Naming string
+	// Relations the relations of the tables to include: table -> name -> relation
+	Relations map[string]map[string]Relation
+	// Tables the columns of the tables without deleted_at, created_at or updated_at: table -> option
+	Tables map[string]TableOption
+	// MetricsTables the tables labeled in the metrics besides the registered tables, the others are labeled as other
+	MetricsTables []string
+	// DetectColumns detect the columns of the tables not in the Tables from the information_schema
+	DetectColumns bool
+	// TxMaxAttempts the max attempts of the transactions on the serialization failures or the deadlocks, default 1
+	TxMaxAttempts int
+	// TxRetryBackoff the base delay of the retries in milliseconds, doubled by the attempt, default 20
+	TxRetryBackoff int
+	// Queries the directory of the named sql files for the common.query, default queries
+	Queries string
+	// AllowDestroy enable the common.destroy biz, which deletes the rows permanently
+	AllowDestroy bool
+	// NotFoundError the common.get and common.first respond the NOT_FOUND error instead of {} if no row matched
+	NotFoundError bool
+	// Logger the fpm logger, the sql logs are written to the stdout if nil
+	Logger log.Logger `json:"-"`
 }
 
 type MigrationHistory struct {
@@ -58,10 +91,51 @@ func NewImpl(db *gorm.DB) db.Database {
 	}
 }
 
+//NewImplWithSetting create a new impl with the options of the setting
+func NewImplWithSetting(db *gorm.DB, setting *DBSetting) db.Database {
+	return &ormImpl{
+		db:           db,
+		timeout:      time.Duration(setting.Timeout) * time.Millisecond,
+		timeFormat:   setting.TimeFormat,
+		detect:       setting.DetectColumns,
+		maxAttempts:  setting.TxMaxAttempts,
+		retryBackoff: time.Duration(setting.TxRetryBackoff) * time.Millisecond,
+	}
+}
+
 //ormImpl the implement of the orm
 type ormImpl struct {
 	// locker sync.Mutex
 	db *gorm.DB
+	// the default timeout of the context queries
+	timeout time.Duration
+	// the format of the time columns in the map results
+	timeFormat string
+	// the soft-delete scope of the queries
+	deleted int
+	// detect the columns of the tables
+	detect bool
+	// in the transaction, and the depth of the savepoints
+	inTx  bool
+	depth int
+	// the max attempts and the base delay of the transaction retries
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+//session create a impl on the tx with the same options
+func (p *ormImpl) session(tx *gorm.DB) *ormImpl {
+	return &ormImpl{
+		db:           tx,
+		timeout:      p.timeout,
+		timeFormat:   p.timeFormat,
+		deleted:      p.deleted,
+		detect:       p.detect,
+		inTx:         p.inTx,
+		depth:        p.depth,
+		maxAttempts:  p.maxAttempts,
+		retryBackoff: p.retryBackoff,
+	}
 }
 
 //New create a new instance
@@ -74,7 +148,7 @@ func New(setting *DBSetting) *gorm.DB {
 
 func GetDB() (*gorm.DB, error) {
 	if dbInstance == nil {
-		return nil, errors.New("NO_INSTANCE_CREATED")
+		return nil, ErrNoInstance
 	}
 	return dbInstance, nil
 }
@@ -83,29 +157,24 @@ func GetDB() (*gorm.DB, error) {
 func CreateDb(setting *DBSetting) *gorm.DB {
 	//use the config for the app
 	dsn := getDbEngineDSN(setting)
-	var logConf logger.Config
-	if setting.ShowSQL {
-		logConf = logger.Config{
-			SlowThreshold: time.Second, // Slow SQL threshold
-			LogLevel:      logger.Info, // Log level
-			Colorful:      false,       // Disable color
-		}
+	var newLogger logger.Interface
+	if setting.Logger != nil {
+		newLogger = NewLogger(setting.Logger, setting)
 	} else {
-		logConf = logger.Config{
-			SlowThreshold: time.Second,   // Slow SQL threshold
-			LogLevel:      logger.Silent, // Log level
-			Colorful:      false,         // Disable color
-		}
+		newLogger = logger.New(
+			stdlog.New(os.Stdout, "\r\n", stdlog.LstdFlags), // io writer
+			logger.Config{
+				SlowThreshold: parseSlowThreshold(setting), // Slow SQL threshold
+				LogLevel:      parseLogLevel(setting),      // Log level
+				Colorful:      false,                       // Disable color
+			},
+		)
 	}
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-		logConf,
-	)
 	var db *gorm.DB
 	if setting.Engine == "postgres" {
 		var err error
 		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-			Logger: newLogger,
+			Logger: &tracingLogger{newLogger},
 		})
 		if err != nil {
 			panic(err)
@@ -152,7 +221,7 @@ func getDbEngineDSN(db *DBSetting) string {
 
 func (p *ormImpl) GetDB() (interface{}, error) {
 	if p.db == nil {
-		return nil, errors.New("NO_INSTANCE_CREATED")
+		return nil, ErrNoInstance
 	}
 	return p.db, nil
 }
@@ -227,13 +296,9 @@ func (p *ormImpl) AutoMigrate(tables ...interface{}) (err error) {
 	return
 }
 
-func (p *ormImpl) Transaction(body func(db.Database) error) error {
-
-	return p.db.Transaction(func(tx *gorm.DB) error {
-		return body(&ormImpl{
-			db: tx,
-		})
-	})
+//Transaction the body is run in a savepoint if it's in a transaction already
+func (p *ormImpl) Transaction(body func(db.Database) error) (err error) {
+	return p.TransactionWith(TxOptions{}, body)
 }
 
 //OK
@@ -244,6 +309,7 @@ func (p *ormImpl) Transaction(body func(db.Database) error) error {
 // 	Asc:    "asc",
 // }).Condition("name = ?", "c").Find(&list).Error()
 func (p *ormImpl) Find(q *db.QueryData, result interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("find", q.Table, begin, err) }(time.Now())
 
 	switch result.(type) {
 	case *[]map[string]interface{}:
@@ -255,26 +321,13 @@ func (p *ormImpl) Find(q *db.QueryData, result interface{}) (err error) {
 		}
 		return
 	}
-	query := p.db.Table(q.Table).Where(fmt.Sprintf("(%s) and deleted_at is null", q.Condition), q.Arguments...)
-	if len(q.Fields) > 0 {
-		fields := make([]interface{}, len(q.Fields))
-		for i, v := range q.Fields {
-			fields[i] = v
-		}
-		query = query.Select(fields[0], fields[1:]...)
-	}
-	query = query.Offset(q.Pager.Skip).Limit(q.Pager.Limit)
-	if len(q.Sorter) > 0 {
-		for _, sort := range q.Sorter {
-			query = query.Order(sort.Sortby + " " + sort.Asc)
-		}
-	}
-	return query.Find(result).Error
+	return p.findQuery(q).Find(result).Error
 
 }
 
-func (p *ormImpl) FindObject(q *db.QueryData) (data []map[string]interface{}, err error) {
-	query := p.db.Table(q.Table).Where(fmt.Sprintf("(%s) and deleted_at is null", q.Condition), q.Arguments...)
+//findQuery build the query of the find
+func (p *ormImpl) findQuery(q *db.QueryData) *gorm.DB {
+	query := p.db.Table(q.Table).Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...)
 	if len(q.Fields) > 0 {
 		fields := make([]interface{}, len(q.Fields))
 		for i, v := range q.Fields {
@@ -288,31 +341,15 @@ func (p *ormImpl) FindObject(q *db.QueryData) (data []map[string]interface{}, er
 			query = query.Order(sort.Sortby + " " + sort.Asc)
 		}
 	}
-	rows, err := query.Rows()
-	if err != nil {
-		return
-	}
-	defer rows.Close()
-	data = make([]map[string]interface{}, 0)
-	cols, _ := rows.Columns()
+	return query
+}
 
-	for rows.Next() {
-		columns := make([]interface{}, len(cols))
-		columnPointers := make([]interface{}, len(cols))
-		for i := range columns {
-			columnPointers[i] = &columns[i]
-		}
-		if err = rows.Scan(columnPointers...); err != nil {
-			return
-		}
-		m := make(map[string]interface{})
-		for i, colName := range cols {
-			val := columnPointers[i].(*interface{})
-			m[colName] = *val
-		}
+func (p *ormImpl) FindObject(q *db.QueryData) (data []map[string]interface{}, err error) {
+	data = make([]map[string]interface{}, 0)
+	err = p.each(q, func(m map[string]interface{}) error {
 		data = append(data, m)
-
-	}
+		return nil
+	})
 	return
 }
 
@@ -321,8 +358,9 @@ func (p *ormImpl) FindObject(q *db.QueryData) (data []map[string]interface{}, er
 // total := 0
 // err = dbclient.Model(Fake{}).Condition("name = ?", "c").Count(&total).Error()
 // total is the count
-func (p *ormImpl) Count(q *db.BaseData, total *int64) error {
-	return p.db.Table(q.Table).Where(fmt.Sprintf("(%s) and deleted_at is null", q.Condition), q.Arguments...).Count(total).Error
+func (p *ormImpl) Count(q *db.BaseData, total *int64) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("count", q.Table, begin, err) }(time.Now())
+	return p.db.Table(q.Table).Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...).Count(total).Error
 }
 
 //OK
@@ -338,10 +376,12 @@ func (p *ormImpl) FindAndCount(q *db.QueryData, result interface{}, total *int64
 }
 
 //OK
+//The NOT_FOUND *Error of the gorm.ErrRecordNotFound is returned if no row matched, for both the struct and the map
 //Ex:
 // one := &Fake{}
 // err = dbclient.Model(one).Condition("name = ?", "c").First(&one).Error()
 func (p *ormImpl) First(q *db.QueryData, result interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("first", q.Table, begin, err) }(time.Now())
 	query := p.db.Table(q.Table)
 	if len(q.Fields) > 0 {
 		fields := make([]interface{}, len(q.Fields))
@@ -356,7 +396,7 @@ func (p *ormImpl) First(q *db.QueryData, result interface{}) (err error) {
 			query = query.Order(sort.Sortby + " " + sort.Asc)
 		}
 	}
-	query.Where(fmt.Sprintf("(%s) and deleted_at is null", q.Condition), q.Arguments...)
+	query.Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...)
 	switch result.(type) {
 	case *map[string]interface{}:
 		rows, e := query.Rows()
@@ -367,36 +407,37 @@ func (p *ormImpl) First(q *db.QueryData, result interface{}) (err error) {
 
 		cols, _ := rows.Columns()
 
-		if rows.Next() {
-			columns := make([]interface{}, len(cols))
-			columnPointers := make([]interface{}, len(cols))
-			for i := range columns {
-				columnPointers[i] = &columns[i]
-			}
-			if err = rows.Scan(columnPointers...); err != nil {
+		if !rows.Next() {
+			if err = rows.Err(); err != nil {
 				return
 			}
-			m := make(map[string]interface{})
-			for i, colName := range cols {
-				val := columnPointers[i].(*interface{})
-				m[colName] = *val
-			}
-			p := result.(*map[string]interface{})
-			*p = m
+			return gorm.ErrRecordNotFound
 		}
-		return nil
+		decoder, e := newColumnDecoder(rows, p.timeFormat)
+		if e != nil {
+			return e
+		}
+		m, e := scanMap(rows, cols, decoder)
+		if e != nil {
+			return e
+		}
+		p := result.(*map[string]interface{})
+		*p = m
+		return rows.Err()
 
 	}
 	return query.First(result).Error
 }
 
 //OK
+//The stored row is written back to the *map[string]interface{}
 //Ex:
 // err = dbclient.Create(&Fake{
 // 	Name:  "c",
 // 	Value: 100,
 // }).Error()
-func (p *ormImpl) Create(q *db.BaseData, entity interface{}) error {
+func (p *ormImpl) Create(q *db.BaseData, entity interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("create", q.Table, begin, err) }(time.Now())
 	d := p.db.Table(q.Table)
 	//判断传入的entity的类型，如果是结构体或者结构体指针，则直接创建
 	objType := reflect.TypeOf(entity)
@@ -413,50 +454,72 @@ func (p *ormImpl) Create(q *db.BaseData, entity interface{}) error {
 	case *map[string]interface{}:
 		one := entity.(*map[string]interface{})
 		e = *one
-		return nil
 	case map[string]interface{}:
 		e = entity.(map[string]interface{})
 	case interface{}:
 		//通过json转义过来的空接口类型，本身可能是 map 类型
 		e = entity.(map[string]interface{})
 	default:
-		return errors.New("unknown data type")
+		return ErrUnknownDataType
 	}
-	//TODO: do sql
-	sql := `INSERT INTO "%s" ("created_at","updated_at","deleted_at",%s) 
-	VALUES (?,?,NULL,%s) RETURNING "id"`
+	sql := `INSERT INTO "%s" (%s) VALUES (%s) RETURNING *`
 	keys := make([]string, 0)
 	vals := make([]string, 0)
-	for k, v := range e {
-		if k == "updateAt" || k == "createAt" || k == "createat" || k == "updateat" {
+	params := make([]interface{}, 0)
+	option := p.tableOption(q.Table)
+	if !option.NoTimestamps {
+		now := time.Now()
+		keys = append(keys, `"created_at"`, `"updated_at"`)
+		vals = append(vals, "?", "?")
+		params = append(params, now, now)
+	}
+	if !option.NoSoftDelete {
+		keys = append(keys, `"deleted_at"`)
+		vals = append(vals, "NULL")
+	}
+	names := make([]string, 0, len(e))
+	for k := range e {
+		if k == "updateAt" || k == "createAt" || k == "createat" || k == "updateat" ||
+			k == "created_at" || k == "updated_at" || k == "deleted_at" {
 			continue
 		}
-		keys = append(keys, "\""+k+"\"")
-		switch v.(type) {
-		case string:
-			vals = append(vals, "'"+v.(string)+"'")
-		case float64:
-			f := v.(float64)
-			if int64(f*1000)%1000 == 0 {
-				// it's a int
-				vals = append(vals, fmt.Sprintf("%d", int64(f)))
-			} else {
-				vals = append(vals, fmt.Sprintf("%f", f))
-			}
-		default:
-			vals = append(vals, "\""+fmt.Sprintf("%v", v)+"\"")
+		if !IsColumn(k) {
+			return Invalidf("INVALID_CREATE: %s", k)
 		}
-
+		names = append(names, k)
+	}
+	// the same columns make the same sql
+	sort.Strings(names)
+	for _, k := range names {
+		// every value is bound, the driver encodes the type of it
+		keys = append(keys, "\""+k+"\"")
+		vals = append(vals, "?")
+		params = append(params, normalizeValue(e[k]))
 	}
 	sql = fmt.Sprintf(sql, q.Table, strings.Join(keys, ","), strings.Join(vals, ","))
 
-	now := time.Now()
-
-	if err := p.db.Exec(sql, now, now).Error; err != nil {
-		return err
+	one, ok := entity.(*map[string]interface{})
+	if !ok {
+		return p.db.Exec(sql, params...).Error
 	}
-
-	return nil
+	// write the stored row back to the map
+	rows, err := p.db.Raw(sql, params...).Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return rows.Err()
+	}
+	cols, _ := rows.Columns()
+	decoder, err := newColumnDecoder(rows, p.timeFormat)
+	if err != nil {
+		return
+	}
+	if *one, err = scanMap(rows, cols, decoder); err != nil {
+		return
+	}
+	return rows.Err()
 }
 
 //OK:
@@ -464,7 +527,16 @@ func (p *ormImpl) Create(q *db.BaseData, entity interface{}) error {
 // rows := 0
 // err = dbclient.Model(Fake{}).Condition("name = ?", "c").Remove(&rows).Error()
 func (p *ormImpl) Remove(q *db.BaseData, total *int64) (err error) {
-
+	defer func(begin time.Time) { err = WrapError(err); observe("remove", q.Table, begin, err) }(time.Now())
+	if p.tableOption(q.Table).NoSoftDelete {
+		// the rows can't be soft-deleted
+		d := p.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", q.Table, q.Condition), q.Arguments...)
+		if err = d.Error; err != nil {
+			return
+		}
+		*total = d.RowsAffected
+		return
+	}
 	raw := p.db.Raw(fmt.Sprintf("UPDATE %s SET deleted_at=? WHERE %s", q.Table, q.Condition), append([]interface{}{time.Now()}, q.Arguments...)...)
 	if raw.Error != nil {
 		err = raw.Error
@@ -484,39 +556,55 @@ func (p *ormImpl) Remove(q *db.BaseData, total *int64) (err error) {
 // }
 // err = dbclient.Model(Fake{}).Condition("name = ?", "c").Updates(fields, &total).Error()
 func (p *ormImpl) Updates(q *db.BaseData, updates db.CommonMap, rows *int64) (err error) {
-	keyArr := make([]string, 0)
-	valArr := make([]interface{}, 0)
+	defer func(begin time.Time) { err = WrapError(err); observe("updates", q.Table, begin, err) }(time.Now())
+	keyArr, params, err := p.updateSets(q.Table, updates, time.Now())
+	if err != nil {
+		return
+	}
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s", q.Table, strings.Join(keyArr[:], ","), p.scoped(q.Table, q.Condition, "deleted_at"))
+	params = append(params, q.Arguments...)
+	d := p.db.Exec(sql, params...)
+	if d.Error != nil {
+		return d.Error
+	}
+	*rows = d.RowsAffected
+	return
+}
+
+//updateSets build the set clause of the updates, the updated_at is set to the now and the version is increased.
+//The value could be a operator like {"$inc": 1}
+func (p *ormImpl) updateSets(table string, updates db.CommonMap, now time.Time) (keyArr []string, params []interface{}, err error) {
+	option := p.tableOption(table)
+	keyArr = make([]string, 0)
+	params = make([]interface{}, 0)
+	if !option.NoTimestamps {
+		keyArr = append(keyArr, "updated_at=?")
+		params = append(params, now)
+	}
+	if option.Version != "" && option.Version != "updated_at" {
+		keyArr = append(keyArr, option.Version+"="+option.Version+"+1")
+	}
 	for k, v := range updates {
 		if k == "" {
 			continue
 		}
-		if k == "updateAt" {
+		if k == "updateAt" || k == "updated_at" || k == option.Version {
 			continue
 		}
-		keyArr = append(keyArr, k+" = ?")
-		switch v.(type) {
-		case float64:
-			f := v.(float64)
-			if int64(f*1000)%1000 == 0 {
-				// it's a int
-				valArr = append(valArr, int64(f))
-				continue
-			}
+		if !IsColumn(k) {
+			return nil, nil, Invalidf("INVALID_UPDATE: %s", k)
 		}
-		valArr = append(valArr, v)
-	}
-	sql := fmt.Sprintf("UPDATE %s SET updated_at=?, %s WHERE deleted_at is null and ( %s )", q.Table, strings.Join(keyArr[:], ","), q.Condition)
-	params := append([]interface{}{time.Now()}, valArr...)
-	params = append(params, q.Arguments...)
-	raw := p.db.Raw(sql, params...)
-	if raw.Error != nil {
-		err = raw.Error
-		return
-	}
-	//TODO: 这里丢失了行数
-	err = raw.Scan(rows).Error
-	if *rows == 0 {
-		*rows = 1
+		expr, args, ok, e := updateExpression(k, v)
+		if e != nil {
+			return nil, nil, e
+		}
+		if ok {
+			keyArr = append(keyArr, expr)
+			params = append(params, args...)
+			continue
+		}
+		keyArr = append(keyArr, k+" = ?")
+		params = append(params, normalizeValue(v))
 	}
 	return
 }
@@ -525,29 +613,16 @@ func (p *ormImpl) Updates(q *db.BaseData, updates db.CommonMap, rows *int64) (er
 //Ex:
 //err = dbclient.Execute(`delete from fake where id = 11`, &rows).Error()
 func (p *ormImpl) Execute(sql string, rows *int64) (err error) {
-	d := p.db.Exec(sql)
-	err = d.Error
-	if err != nil {
-		return
-	}
-	*rows = d.RowsAffected
-	return d.Error
+	return p.ExecuteArgs(sql, rows)
 }
 
 //OK:
-//The result must be a struct
+//The result could be a struct, *map[string]interface{} or *[]map[string]interface{}
 //Ex:
 // raw := &countBody{}
 // err = dbclient.Raw(`select count(1) as c from fake where id < 10`, raw).Error()
 func (p *ormImpl) Raw(sql string, result interface{}) (err error) {
-	raw := p.db.Raw(sql)
-	if raw.Error != nil {
-		err = raw.Error
-		return
-	}
-	err = raw.Scan(result).Error
-
-	return
+	return p.RawArgs(sql, result)
 }
 
 //OK should be a struct
@@ -559,17 +634,5 @@ func (p *ormImpl) Raw(sql string, result interface{}) (err error) {
 // 	raws = append(raws, one.(*countBody))
 // }).Error()
 func (p *ormImpl) Raws(sql string, iterator func() interface{}, appender func(interface{})) (err error) {
-	d := p.db.Raw(sql)
-	raws, err := d.Rows()
-	if err != nil {
-		return err
-	}
-	defer raws.Close()
-	for raws.Next() {
-		one := iterator()
-		d.ScanRows(raws, one)
-		appender(one)
-	}
-
-	return nil
+	return p.RawsArgs(sql, iterator, appender)
 }
@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+//captureDriver the driver records the last statement, the exec affects 3 rows, the query returns the row of id 1
+type captureDriver struct {
+	query *string
+	args  *[]driver.Value
+}
+
+func (d captureDriver) Open(string) (driver.Conn, error) { return d, nil }
+
+func (d captureDriver) Prepare(query string) (driver.Stmt, error) {
+	*d.query = query
+	return d, nil
+}
+
+func (d captureDriver) Close() error { return nil }
+
+func (d captureDriver) Begin() (driver.Tx, error) { return nil, io.ErrUnexpectedEOF }
+
+func (d captureDriver) NumInput() int { return -1 }
+
+func (d captureDriver) Exec(args []driver.Value) (driver.Result, error) {
+	*d.args = args
+	return driver.RowsAffected(3), nil
+}
+
+func (d captureDriver) Query(args []driver.Value) (driver.Rows, error) {
+	*d.args = args
+	return &storedRows{}, nil
+}
+
+type storedRows struct {
+	done bool
+}
+
+func (*storedRows) Columns() []string { return []string{"id", "name"} }
+
+func (*storedRows) Close() error { return nil }
+
+func (r *storedRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = int64(1), "stored"
+	return nil
+}
+
+var (
+	capturedQuery string
+	capturedArgs  []driver.Value
+)
+
+func init() {
+	sql.Register("capture", captureDriver{query: &capturedQuery, args: &capturedArgs})
+}
+
+func TestCreateMap(t *testing.T) {
+	conn, err := sql.Open("capture", "")
+	assert.Nil(t, err, "should nil err")
+	d, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err, "should nil err")
+	impl := &ormImpl{db: d}
+
+	q := db.NewQuery()
+	q.SetTable("fake")
+	row := map[string]interface{}{"value": int64(1 << 60), "enabled": true, "memo": nil, "name": "a'b"}
+	err = impl.Create(q.BaseData, &row)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `INSERT INTO "fake" ("created_at","updated_at","deleted_at","enabled","memo","name","value") VALUES ($1,$2,NULL,$3,$4,$5,$6) RETURNING *`, capturedQuery, "")
+	assert.Len(t, capturedArgs, 6, "")
+	assert.IsType(t, time.Time{}, capturedArgs[0], "")
+	assert.Equal(t, []driver.Value{true, nil, "a'b", int64(1 << 60)}, capturedArgs[2:], "should bind every value")
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "name": "stored"}, row, "should be the stored row")
+
+	err = impl.Create(q.BaseData, map[string]interface{}{`name" = 1 --`: 1})
+	assert.NotNil(t, err, "should err with the invalid column")
+}
+
+func TestUpdatesRows(t *testing.T) {
+	conn, err := sql.Open("capture", "")
+	assert.Nil(t, err, "should nil err")
+	d, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err, "should nil err")
+	impl := &ormImpl{db: d}
+
+	q := db.NewQuery()
+	q.SetTable("fake").SetCondition("id = ?", 1)
+	var rows int64
+	err = impl.Updates(q.BaseData, db.CommonMap{"name": "b"}, &rows)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, int64(3), rows, "should be the affected rows")
+	assert.True(t, strings.HasPrefix(capturedQuery, "UPDATE fake SET "), "")
+}
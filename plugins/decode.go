@@ -0,0 +1,248 @@
+package plugins
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//TimeFormatEpoch the time columns are decoded as the epoch millis
+const TimeFormatEpoch = "epoch"
+
+//columnDecoder decode the raw driver values by the database type of the columns
+type columnDecoder struct {
+	types      []string
+	timeFormat string
+}
+
+func newColumnDecoder(rows *sql.Rows, timeFormat string) (*columnDecoder, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = strings.ToUpper(ct.DatabaseTypeName())
+	}
+	return &columnDecoder{
+		types:      types,
+		timeFormat: timeFormat,
+	}, nil
+}
+
+//decode the value of the i-th column, the raw value is kept if it can't be decoded
+func (d *columnDecoder) decode(i int, v interface{}) interface{} {
+	if v == nil || i >= len(d.types) {
+		return v
+	}
+	switch val := v.(type) {
+	case time.Time:
+		return formatTime(val, d.timeFormat)
+	case float64:
+		if s, ok := nonFinite(val); ok {
+			return s
+		}
+		return v
+	case float32:
+		if s, ok := nonFinite(float64(val)); ok {
+			return s
+		}
+		return v
+	}
+	typ := d.types[i]
+	if typ == "BYTEA" {
+		return v
+	}
+	var raw string
+	switch val := v.(type) {
+	case string:
+		raw = val
+	case []byte:
+		raw = string(val)
+	default:
+		return v
+	}
+	switch {
+	case typ == "NUMERIC" || typ == "DECIMAL":
+		if n, ok := parseNumber(raw); ok {
+			return n
+		}
+	case typ == "JSON" || typ == "JSONB":
+		var data interface{}
+		if err := json.Unmarshal([]byte(raw), &data); err == nil {
+			return data
+		}
+	case strings.HasPrefix(typ, "_"):
+		if list, ok := parseArray(raw, typ[1:]); ok {
+			return list
+		}
+	}
+	return v
+}
+
+//formatTime format the time by the format: empty keeps the time.Time, epoch for the epoch millis, or a layout
+func formatTime(t time.Time, format string) interface{} {
+	switch format {
+	case "":
+		return t
+	case TimeFormatEpoch:
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+	return t.Format(format)
+}
+
+//formatTimes format the time values of the rows scanned with no format
+func formatTimes(list []map[string]interface{}, format string) []map[string]interface{} {
+	if format == "" {
+		return list
+	}
+	for _, row := range list {
+		for k, v := range row {
+			if t, ok := v.(time.Time); ok {
+				row[k] = formatTime(t, format)
+			}
+		}
+	}
+	return list
+}
+
+//parseNumber parse the numeric text into int64, float64 if it's exact, or json.Number to keep the precision,
+//NaN and ±Infinity are kept as the string, the json can't encode them
+func parseNumber(raw string) (interface{}, bool) {
+	if n, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		if e, ok := err.(*strconv.NumError); ok && e.Err == strconv.ErrRange {
+			return json.Number(raw), true
+		}
+		return nil, false
+	}
+	if s, ok := nonFinite(f); ok {
+		return s, true
+	}
+	if strconv.FormatFloat(f, 'f', -1, 64) != trimFraction(raw) {
+		return json.Number(raw), true
+	}
+	return f, true
+}
+
+//parseFloat parse the float4/float8 text, NaN and ±Infinity are kept as the string
+func parseFloat(raw string) (interface{}, bool) {
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, false
+	}
+	if s, ok := nonFinite(f); ok {
+		return s, true
+	}
+	return f, true
+}
+
+//nonFinite the text of the NaN and ±Infinity like the postgres
+func nonFinite(f float64) (string, bool) {
+	switch {
+	case math.IsNaN(f):
+		return "NaN", true
+	case math.IsInf(f, 1):
+		return "Infinity", true
+	case math.IsInf(f, -1):
+		return "-Infinity", true
+	}
+	return "", false
+}
+
+//trimFraction trim the trailing zeros of the fraction: 10.50 to 10.5, 1.0 to 1
+func trimFraction(raw string) string {
+	if !strings.Contains(raw, ".") || strings.ContainsAny(raw, "eE") {
+		return raw
+	}
+	return strings.TrimSuffix(strings.TrimRight(raw, "0"), ".")
+}
+
+//parseArray parse the postgres array literal like {1,2,"a b",NULL} into a slice,
+//the elements are decoded by the element type
+func parseArray(raw, elemType string) ([]interface{}, bool) {
+	list, rest, ok := parseArrayLiteral(raw, elemType)
+	if !ok || strings.TrimSpace(rest) != "" {
+		return nil, false
+	}
+	return list, true
+}
+
+func parseArrayLiteral(raw, elemType string) (list []interface{}, rest string, ok bool) {
+	if !strings.HasPrefix(raw, "{") {
+		return nil, raw, false
+	}
+	raw = raw[1:]
+	list = make([]interface{}, 0)
+	if strings.HasPrefix(raw, "}") {
+		return list, raw[1:], true
+	}
+	for {
+		var elem interface{}
+		switch {
+		case strings.HasPrefix(raw, "{"):
+			if elem, raw, ok = parseArrayLiteral(raw, elemType); !ok {
+				return nil, raw, false
+			}
+		case strings.HasPrefix(raw, `"`):
+			var b strings.Builder
+			i := 1
+			for ; i < len(raw) && raw[i] != '"'; i++ {
+				if raw[i] == '\\' && i+1 < len(raw) {
+					i++
+				}
+				b.WriteByte(raw[i])
+			}
+			if i >= len(raw) {
+				return nil, raw, false
+			}
+			elem = decodeArrayElem(b.String(), elemType, true)
+			raw = raw[i+1:]
+		default:
+			i := strings.IndexAny(raw, ",}")
+			if i < 0 {
+				return nil, raw, false
+			}
+			elem = decodeArrayElem(raw[:i], elemType, false)
+			raw = raw[i:]
+		}
+		list = append(list, elem)
+		if raw == "" {
+			return nil, raw, false
+		}
+		if raw[0] == '}' {
+			return list, raw[1:], true
+		}
+		raw = raw[1:]
+	}
+}
+
+func decodeArrayElem(s, elemType string, quoted bool) interface{} {
+	if !quoted && s == "NULL" {
+		return nil
+	}
+	switch elemType {
+	case "INT2", "INT4", "INT8", "NUMERIC":
+		if n, ok := parseNumber(s); ok {
+			return n
+		}
+	case "FLOAT4", "FLOAT8":
+		if f, ok := parseFloat(s); ok {
+			return f
+		}
+	case "BOOL":
+		return s == "t" || s == "true"
+	case "JSON", "JSONB":
+		var data interface{}
+		if err := json.Unmarshal([]byte(s), &data); err == nil {
+			return data
+		}
+	}
+	return s
+}
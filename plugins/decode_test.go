@@ -0,0 +1,39 @@
+package plugins
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColumnDecoder(t *testing.T) {
+	d := &columnDecoder{
+		types:      []string{"NUMERIC", "JSONB", "_INT4", "_TEXT", "TIMESTAMPTZ", "NUMERIC"},
+		timeFormat: TimeFormatEpoch,
+	}
+	assert.Equal(t, int64(100), d.decode(0, "100"), "")
+	assert.Equal(t, 10.5, d.decode(5, []byte("10.5")), "")
+	assert.Equal(t, map[string]interface{}{"a": []interface{}{1.0}}, d.decode(1, `{"a":[1]}`), "")
+	assert.Equal(t, []interface{}{int64(1), nil, []interface{}{int64(2)}}, d.decode(2, "{1,NULL,{2}}"), "")
+	assert.Equal(t, []interface{}{"a b", `c"d`, "e"}, d.decode(3, `{"a b","c\"d",e}`), "")
+	assert.Equal(t, []interface{}{}, d.decode(3, "{}"), "")
+	assert.Equal(t, "{bad", d.decode(3, "{bad"), "should keep the raw value")
+
+	assert.Equal(t, 10.5, d.decode(0, "10.50"), "")
+	assert.Equal(t, "NaN", d.decode(0, "NaN"), "")
+	assert.Equal(t, json.Number("12345678901234567890.123"), d.decode(0, "12345678901234567890.123"), "should keep the precision")
+	assert.Equal(t, json.Number("0.30000000000000000001"), d.decode(0, "0.30000000000000000001"), "")
+	d.types = append(d.types, "FLOAT8", "_FLOAT8")
+	assert.Equal(t, "Infinity", d.decode(6, math.Inf(1)), "")
+	assert.Equal(t, []interface{}{1.5, "-Infinity", "NaN"}, d.decode(7, "{1.5,-Infinity,NaN}"), "")
+	_, err := json.Marshal([]interface{}{d.decode(0, "NaN"), d.decode(6, math.NaN())})
+	assert.Nil(t, err, "should be encoded")
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Equal(t, at.Unix()*1000, d.decode(4, at), "")
+	d.timeFormat = "2006-01-02 15:04:05"
+	assert.Equal(t, "2020-01-02 03:04:05", d.decode(4, at), "")
+}
@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/gorm"
+)
+
+//DistinctFinder find the distinct values of the columns
+type DistinctFinder interface {
+	Distinct(q *db.QueryData, result *[]map[string]interface{}) error
+
+	DistinctContext(ctx context.Context, q *db.QueryData, result *[]map[string]interface{}) error
+}
+
+//OK
+//The Fields are the distinct columns, the Sorter should be in the Fields
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake").SetCondition("value > ?", 1)
+// q.AddFields("name").SetPager(&db.Pagination{Limit: 10})
+// err = dbclient.(plugins.DistinctFinder).Distinct(q, &list)
+func (p *ormImpl) Distinct(q *db.QueryData, result *[]map[string]interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("distinct", q.Table, begin, err) }(time.Now())
+	query, err := p.distinctQuery(q)
+	if err != nil {
+		return
+	}
+	return p.eachQuery(query, func(m map[string]interface{}) error {
+		*result = append(*result, m)
+		return nil
+	})
+}
+
+func (p *ormImpl) DistinctContext(ctx context.Context, q *db.QueryData, result *[]map[string]interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Distinct(q, result)
+}
+
+func (p *ormImpl) distinctQuery(q *db.QueryData) (*gorm.DB, error) {
+	if len(q.Fields) == 0 {
+		return nil, Invalidf("INVALID_DISTINCT: no fields")
+	}
+	for _, f := range q.Fields {
+		if !IsColumn(f) {
+			return nil, Invalidf("INVALID_DISTINCT: %s", f)
+		}
+	}
+	query := p.db.Table(q.Table).Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...).
+		Select("DISTINCT " + strings.Join(q.Fields, ","))
+	for _, sort := range q.Sorter {
+		if !containsString(q.Fields, sort.Sortby) {
+			return nil, Invalidf("INVALID_SORT: %s should be in the fields", sort.Sortby)
+		}
+		query = query.Order(sort.Sortby + " " + sort.Asc)
+	}
+	return query.Offset(q.Pager.Skip).Limit(q.Pager.Limit), nil
+}
@@ -0,0 +1,25 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestDistinctQuery(t *testing.T) {
+	q := db.NewQuery()
+	q.SetTable("fake").SetCondition("value > ?", 1)
+	q.AddFields("name", "value").AddSorter(db.Sorter{Sortby: "name", Asc: "asc"})
+
+	query, err := dryRunImpl(t).distinctQuery(q)
+	assert.Nil(t, err, "should nil err")
+	list := make([]map[string]interface{}, 0)
+	stmt := query.Find(&list).Statement
+	assert.Equal(t, `SELECT DISTINCT name,value FROM "fake" WHERE (value > $1) and deleted_at is null ORDER BY name asc`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	q.AddSorter(db.Sorter{Sortby: "id", Asc: "asc"})
+	_, err = dryRunImpl(t).distinctQuery(q)
+	assert.NotNil(t, err, "should err on the sort out of the fields")
+}
@@ -0,0 +1,210 @@
+package plugins
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"gorm.io/gorm"
+)
+
+var (
+	//ErrNoInstance the db instance not created
+	ErrNoInstance = errors.New("NO_INSTANCE_CREATED")
+	//ErrUnknownDataType the entity is neither a struct nor a map
+	ErrUnknownDataType = errors.New("unknown data type")
+	//ErrInvalidArgument matches the INVALID_* errors of the arguments by errors.Is
+	ErrInvalidArgument = errors.New("INVALID_ARGUMENT")
+)
+
+//invalidError the INVALID_* error, which is the ErrInvalidArgument
+type invalidError struct {
+	msg string
+}
+
+func (e *invalidError) Error() string {
+	return e.msg
+}
+
+func (e *invalidError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+//Invalidf create the INVALID_* error of the arguments like INVALID_SORT: name,
+//errors.Is(err, ErrInvalidArgument) matches it
+func Invalidf(format string, args ...interface{}) error {
+	return &invalidError{msg: fmt.Sprintf(format, args...)}
+}
+
+//ErrorCode the code of the database failure
+type ErrorCode string
+
+const (
+	//CodeNotFound no row matched
+	CodeNotFound ErrorCode = "NOT_FOUND"
+	//CodeUniqueViolation the unique constraint violated(23505)
+	CodeUniqueViolation ErrorCode = "UNIQUE_VIOLATION"
+	//CodeForeignKeyViolation the foreign key constraint violated(23503)
+	CodeForeignKeyViolation ErrorCode = "FOREIGN_KEY_VIOLATION"
+	//CodeCheckViolation the check constraint violated(23514)
+	CodeCheckViolation ErrorCode = "CHECK_VIOLATION"
+	//CodeNotNullViolation the not null constraint violated(23502)
+	CodeNotNullViolation ErrorCode = "NOT_NULL_VIOLATION"
+	//CodeSerializationFailure the serialization failure(40001) or the deadlock(40P01) after the retries
+	CodeSerializationFailure ErrorCode = "SERIALIZATION_FAILURE"
+	//CodeVersionConflict the *ConflictError of the optimistic locking
+	CodeVersionConflict ErrorCode = "VERSION_CONFLICT"
+	//CodeTimeout the ctx done or the statement canceled(57014)
+	CodeTimeout ErrorCode = "TIMEOUT"
+	//CodeConnectionLost the connection failed, closed or the server shut down
+	CodeConnectionLost ErrorCode = "CONNECTION_LOST"
+	//CodeInvalidArgument the INVALID_* errors of the arguments
+	CodeInvalidArgument ErrorCode = "INVALID_ARGUMENT"
+	//CodeUnknown the other errors
+	CodeUnknown ErrorCode = "DB_ERROR"
+)
+
+var codeStatus = map[ErrorCode]int{
+	CodeNotFound:             http.StatusNotFound,
+	CodeUniqueViolation:      http.StatusConflict,
+	CodeForeignKeyViolation:  http.StatusConflict,
+	CodeCheckViolation:       http.StatusBadRequest,
+	CodeNotNullViolation:     http.StatusBadRequest,
+	CodeSerializationFailure: http.StatusConflict,
+	CodeVersionConflict:      http.StatusConflict,
+	CodeTimeout:              http.StatusGatewayTimeout,
+	CodeConnectionLost:       http.StatusServiceUnavailable,
+	CodeInvalidArgument:      http.StatusBadRequest,
+}
+
+//Status the http status of the code, 500 for the unknown
+func (c ErrorCode) Status() int {
+	if status, ok := codeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+//Error the database failure mapped from the driver error, the driver error is unwrapped by errors.As
+type Error struct {
+	Code ErrorCode
+	// Constraint the name of the violated constraint, if reported by the driver
+	Constraint string
+	// Table the table of the violation, if reported by the driver
+	Table string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+//WrapError map the driver error to the *Error, the other errors are returned as is
+//Ex:
+// err = dbclient.Create(q.BaseData, &one)
+// var e *plugins.Error
+// if errors.As(err, &e) && e.Code == plugins.CodeUniqueViolation {
+// 	// e.Constraint is the violated unique index
+// }
+func WrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	code := driverCode(err)
+	if code == "" {
+		return err
+	}
+	e = &Error{Code: code, Err: err}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		e.Constraint = pgErr.ConstraintName
+		e.Table = pgErr.TableName
+	}
+	return e
+}
+
+//ErrorCodeOf get the code of the err, empty for the nil
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		return CodeVersionConflict
+	}
+	if code := driverCode(err); code != "" {
+		return code
+	}
+	if errors.Is(err, ErrNoInstance) {
+		return CodeConnectionLost
+	}
+	if errors.Is(err, ErrUnknownDataType) || errors.Is(err, ErrInvalidArgument) {
+		return CodeInvalidArgument
+	}
+	return CodeUnknown
+}
+
+//driverCode the code of the driver error, empty if not mapped
+func driverCode(err error) ErrorCode {
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, sql.ErrNoRows) {
+		return CodeNotFound
+	}
+	switch state := sqlState(err); {
+	case state == "23505":
+		return CodeUniqueViolation
+	case state == "23503":
+		return CodeForeignKeyViolation
+	case state == "23514":
+		return CodeCheckViolation
+	case state == "23502":
+		return CodeNotNullViolation
+	case state == "40001" || state == "40P01":
+		return CodeSerializationFailure
+	case state == "57014":
+		return CodeTimeout
+	case strings.HasPrefix(state, "08") || state == "57P01" || state == "57P02" || state == "57P03":
+		// the connection exception, the admin or crash shutdown, cannot connect now
+		return CodeConnectionLost
+	case state != "":
+		return ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return CodeTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return CodeTimeout
+		}
+		return CodeConnectionLost
+	}
+	// the pgconn fails before sending, like the closed conn
+	var unsent interface{ SafeToRetry() bool }
+	if errors.As(err, &unsent) && unsent.SafeToRetry() {
+		return CodeConnectionLost
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return CodeConnectionLost
+	}
+	return ""
+}
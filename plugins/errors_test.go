@@ -0,0 +1,63 @@
+package plugins
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWrapError(t *testing.T) {
+	err := WrapError(fmt.Errorf("create: %w", &pgconn.PgError{Code: "23505", ConstraintName: "fake_name_key", TableName: "fake"}))
+	var e *Error
+	assert.True(t, errors.As(err, &e), "should be mapped")
+	assert.Equal(t, CodeUniqueViolation, e.Code, "")
+	assert.Equal(t, "fake_name_key", e.Constraint, "")
+	assert.Equal(t, "fake", e.Table, "")
+	assert.Equal(t, "23505", sqlState(err), "the driver error should be unwrapped")
+	assert.Equal(t, err, WrapError(err), "should not be wrapped twice")
+
+	assert.Equal(t, CodeNotFound, ErrorCodeOf(WrapError(gorm.ErrRecordNotFound)), "")
+	assert.True(t, errors.Is(WrapError(gorm.ErrRecordNotFound), gorm.ErrRecordNotFound), "")
+	assert.Equal(t, CodeForeignKeyViolation, ErrorCodeOf(WrapError(stateError("23503"))), "")
+	assert.Equal(t, CodeCheckViolation, ErrorCodeOf(WrapError(stateError("23514"))), "")
+	assert.Equal(t, CodeTimeout, ErrorCodeOf(WrapError(stateError("57014"))), "")
+	assert.Equal(t, CodeTimeout, ErrorCodeOf(WrapError(fmt.Errorf("query: %w", context.DeadlineExceeded))), "")
+	assert.Equal(t, CodeConnectionLost, ErrorCodeOf(WrapError(stateError("08006"))), "")
+	assert.Equal(t, CodeConnectionLost, ErrorCodeOf(WrapError(driver.ErrBadConn)), "")
+	assert.Equal(t, CodeConnectionLost, ErrorCodeOf(WrapError(fmt.Errorf("query: %w", unsentError{}))), "")
+
+	other := errors.New("foo")
+	assert.Equal(t, other, WrapError(other), "the other errors should be returned as is")
+	assert.Equal(t, stateError("42P01"), WrapError(stateError("42P01")), "")
+	assert.Nil(t, WrapError(nil), "")
+}
+
+//unsentError the pgconn error before sending, like the closed conn
+type unsentError struct{}
+
+func (unsentError) Error() string { return "conn closed" }
+
+func (unsentError) SafeToRetry() bool { return true }
+
+func TestErrorCodeOf(t *testing.T) {
+	assert.Equal(t, ErrorCode(""), ErrorCodeOf(nil), "")
+	assert.Equal(t, CodeVersionConflict, ErrorCodeOf(&ConflictError{Table: "fake", Version: 1}), "")
+	err := Invalidf("INVALID_SORT: %s", "foo")
+	assert.Equal(t, "INVALID_SORT: foo", err.Error(), "")
+	assert.Equal(t, CodeInvalidArgument, ErrorCodeOf(fmt.Errorf("find: %w", err)), "")
+	assert.Equal(t, CodeUnknown, ErrorCodeOf(errors.New("INVALID_SORT: foo")), "should not match the message")
+	assert.Equal(t, CodeInvalidArgument, ErrorCodeOf(ErrUnknownDataType), "")
+	assert.Equal(t, CodeConnectionLost, ErrorCodeOf(ErrNoInstance), "")
+	assert.Equal(t, CodeUnknown, ErrorCodeOf(errors.New("foo")), "")
+
+	assert.Equal(t, http.StatusNotFound, CodeNotFound.Status(), "")
+	assert.Equal(t, http.StatusConflict, CodeUniqueViolation.Status(), "")
+	assert.Equal(t, http.StatusInternalServerError, CodeUnknown.Status(), "")
+}
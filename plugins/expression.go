@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//updateOperator build the set expression of the column by the operand
+type updateOperator func(column string, operand interface{}) (expr string, args []interface{}, err error)
+
+//updateOperators the operators of the updates, like {"value": {"$inc": 1}}
+var updateOperators = map[string]updateOperator{
+	// value = value + 1
+	"$inc": func(column string, operand interface{}) (string, []interface{}, error) {
+		return column + " = " + column + " + ?", []interface{}{normalizeValue(operand)}, nil
+	},
+	// value = value * 2
+	"$mul": func(column string, operand interface{}) (string, []interface{}, error) {
+		return column + " = " + column + " * ?", []interface{}{normalizeValue(operand)}, nil
+	},
+	// note = NULL
+	"$set": func(column string, operand interface{}) (string, []interface{}, error) {
+		if operand == nil {
+			return column + " = NULL", nil, nil
+		}
+		return column + " = ?", []interface{}{normalizeValue(operand)}, nil
+	},
+	// updated_by = now()
+	"$now": func(column string, _ interface{}) (string, []interface{}, error) {
+		return column + " = now()", nil, nil
+	},
+	// tags = array_append(tags, 'a'), the operand could be a array of the elements
+	"$append": func(column string, operand interface{}) (string, []interface{}, error) {
+		elements, ok := operand.([]interface{})
+		if !ok {
+			elements = []interface{}{operand}
+		}
+		expr := column
+		args := make([]interface{}, 0, len(elements))
+		for _, e := range elements {
+			expr = "array_append(" + expr + ", ?)"
+			args = append(args, normalizeValue(e))
+		}
+		return column + " = " + expr, args, nil
+	},
+	// meta = meta || '{"a":1}', the keys of the jsonb are merged
+	"$merge": func(column string, operand interface{}) (string, []interface{}, error) {
+		raw, err := json.Marshal(operand)
+		if err != nil {
+			return "", nil, err
+		}
+		return column + " = COALESCE(" + column + ", '{}'::jsonb) || ?::jsonb", []interface{}{string(raw)}, nil
+	},
+}
+
+//updateExpression build the set expression if the value is a operator like {"$inc": 1}, ok is false for the plain value
+func updateExpression(column string, value interface{}) (expr string, args []interface{}, ok bool, err error) {
+	var operation map[string]interface{}
+	switch value.(type) {
+	case map[string]interface{}:
+		operation = value.(map[string]interface{})
+	case db.CommonMap:
+		operation = value.(db.CommonMap)
+	default:
+		return
+	}
+	if len(operation) != 1 {
+		return
+	}
+	for name, operand := range operation {
+		if !strings.HasPrefix(name, "$") {
+			return
+		}
+		operator, exists := updateOperators[strings.ToLower(name)]
+		if !exists {
+			return "", nil, true, Invalidf("INVALID_UPDATE: %s of %s", name, column)
+		}
+		expr, args, err = operator(column, operand)
+		return expr, args, true, err
+	}
+	return
+}
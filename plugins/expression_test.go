@@ -0,0 +1,40 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestUpdateExpression(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		expr  string
+		args  []interface{}
+	}{
+		{map[string]interface{}{"$inc": float64(1)}, "value = value + ?", []interface{}{int64(1)}},
+		{db.CommonMap{"$mul": 1.5}, "value = value * ?", []interface{}{1.5}},
+		{map[string]interface{}{"$set": nil}, "value = NULL", nil},
+		{map[string]interface{}{"$now": true}, "value = now()", nil},
+		{map[string]interface{}{"$append": []interface{}{"a", "b"}}, "value = array_append(array_append(value, ?), ?)", []interface{}{"a", "b"}},
+		{map[string]interface{}{"$merge": map[string]interface{}{"a": 1}}, "value = COALESCE(value, '{}'::jsonb) || ?::jsonb", []interface{}{`{"a":1}`}},
+	}
+	for _, c := range cases {
+		expr, args, ok, err := updateExpression("value", c.value)
+		assert.Nil(t, err, "should nil err")
+		assert.True(t, ok, "should be a operator")
+		assert.Equal(t, c.expr, expr, "")
+		assert.Equal(t, c.args, args, "")
+	}
+
+	_, _, ok, _ := updateExpression("value", map[string]interface{}{"a": 1})
+	assert.False(t, ok, "the plain map is a value")
+
+	_, _, _, err := updateExpression("value", map[string]interface{}{"$drop": 1})
+	assert.NotNil(t, err, "should err on the unknown operator")
+
+	_, _, err = dryRunImpl(t).updateSets("fake", db.CommonMap{"value = 1; --": 1}, time.Now())
+	assert.NotNil(t, err, "should err on the invalid column")
+}
@@ -0,0 +1,153 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/team4yf/fpm-go-pkg/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var (
+	reSQLString   = regexp.MustCompile(`'(?:[^']|'')*'`)
+	reSQLNumber   = regexp.MustCompile(`\$?\b\d+(?:\.\d+)?\b`)
+	reSQLTable    = regexp.MustCompile(`(?i)\b(?:from|into|update|join)\s+"?([\w.]+)"?`)
+	reSQLOperator = regexp.MustCompile(`^\s*(\w+)`)
+)
+
+//fpmLogger route the sql logs of the gorm to the fpm logger
+type fpmLogger struct {
+	logger        log.Logger
+	level         logger.LogLevel
+	slowThreshold time.Duration
+	redact        bool
+}
+
+//NewLogger create a gorm logger which writes into the fpm logger
+func NewLogger(l log.Logger, setting *DBSetting) logger.Interface {
+	return &fpmLogger{
+		logger:        l,
+		level:         parseLogLevel(setting),
+		slowThreshold: parseSlowThreshold(setting),
+		redact:        setting.RedactParams,
+	}
+}
+
+//parseLogLevel the level of the logLevel, the showSQL is the info level if not set
+func parseLogLevel(setting *DBSetting) logger.LogLevel {
+	switch strings.ToLower(setting.LogLevel) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "warn":
+		return logger.Warn
+	case "info":
+		return logger.Info
+	}
+	if setting.ShowSQL {
+		return logger.Info
+	}
+	return logger.Silent
+}
+
+//parseSlowThreshold the threshold of the slow sql, 1 second by default
+func parseSlowThreshold(setting *DBSetting) time.Duration {
+	if setting.SlowThreshold > 0 {
+		return time.Duration(setting.SlowThreshold) * time.Millisecond
+	}
+	return time.Second
+}
+
+//LogMode change the level of the logger
+func (l *fpmLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = level
+	return &newLogger
+}
+
+//Info print info
+func (l *fpmLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		l.logger.Infof(msg, data...)
+	}
+}
+
+//Warn print warn messages
+func (l *fpmLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		l.logger.Warnf(msg, data...)
+	}
+}
+
+//Error print error messages
+func (l *fpmLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		l.logger.Errorf(msg, data...)
+	}
+}
+
+//Trace print the sql with the structured fields: table, operation, duration(ms), rows.
+//The not found is printed at the debug level
+func (l *fpmLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	fields := func() (log.Logger, string) {
+		sql, rows := fc()
+		if l.redact {
+			sql = redactSQL(sql)
+		}
+		operation, table := parseStatement(sql)
+		return l.logger.WithFields(log.Fields{
+			"table":     table,
+			"operation": operation,
+			"duration":  float64(elapsed.Nanoseconds()) / 1e6,
+			"rows":      rows,
+		}), sql
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// the empty result of the first is not a failure
+		if l.level >= logger.Info {
+			entry, sql := fields()
+			entry.Debugf("%s: %v", sql, err)
+		}
+	case err != nil && l.level >= logger.Error:
+		entry, sql := fields()
+		entry.Errorf("%s: %v", sql, err)
+	case elapsed > l.slowThreshold && l.level >= logger.Warn:
+		entry, sql := fields()
+		entry.Warnf("SLOW SQL >= %v: %s", l.slowThreshold, sql)
+	case l.level >= logger.Info:
+		entry, sql := fields()
+		entry.Info(sql)
+	}
+}
+
+//redactSQL replace the literal values of the sql with ?, the numbered placeholders like $1 are kept
+func redactSQL(sql string) string {
+	sql = reSQLString.ReplaceAllString(sql, "?")
+	return reSQLNumber.ReplaceAllStringFunc(sql, func(number string) string {
+		if strings.HasPrefix(number, "$") {
+			return number
+		}
+		return "?"
+	})
+}
+
+//parseStatement get the operation and the table from the sql
+func parseStatement(sql string) (operation, table string) {
+	if m := reSQLOperator.FindStringSubmatch(sql); m != nil {
+		operation = strings.ToUpper(m[1])
+	}
+	if m := reSQLTable.FindStringSubmatch(sql); m != nil {
+		table = m[1]
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/fpm-go-pkg/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRedactSQL(t *testing.T) {
+	sql := redactSQL(`SELECT * FROM "fake2" WHERE name = 'it''s' and value > 10.5 LIMIT 1`)
+	assert.Equal(t, `SELECT * FROM "fake2" WHERE name = ? and value > ? LIMIT ?`, sql, "")
+	sql = redactSQL(`UPDATE fake SET value=$1 WHERE id = $2 and value > 10`)
+	assert.Equal(t, `UPDATE fake SET value=$1 WHERE id = $2 and value > ?`, sql, "should keep the placeholders")
+}
+
+func TestParseStatement(t *testing.T) {
+	operation, table := parseStatement(`UPDATE fake SET deleted_at=? WHERE name = 'c'`)
+	assert.Equal(t, "UPDATE", operation, "")
+	assert.Equal(t, "fake", table, "")
+
+	operation, table = parseStatement(`insert into "fake" ("name") values ('c')`)
+	assert.Equal(t, "INSERT", operation, "")
+	assert.Equal(t, "fake", table, "")
+}
+
+//levelLogger record the levels of the printed logs
+type levelLogger struct {
+	log.Logger
+	levels *[]string
+}
+
+func (l levelLogger) WithFields(log.Fields) log.Logger { return l }
+
+func (l levelLogger) Debugf(string, ...interface{}) { *l.levels = append(*l.levels, "debug") }
+
+func (l levelLogger) Errorf(string, ...interface{}) { *l.levels = append(*l.levels, "error") }
+
+func TestTraceNotFound(t *testing.T) {
+	levels := make([]string, 0)
+	sql := func() (string, int64) { return `SELECT * FROM "fake" LIMIT 1`, 0 }
+	l := NewLogger(levelLogger{levels: &levels}, &DBSetting{LogLevel: "error"})
+	l.Trace(context.Background(), time.Now(), sql, gorm.ErrRecordNotFound)
+	assert.Equal(t, []string{}, levels, "should skip the not found")
+	l.Trace(context.Background(), time.Now(), sql, errors.New("failed"))
+	assert.Equal(t, []string{"error"}, levels, "")
+
+	l = l.LogMode(logger.Info)
+	l.Trace(context.Background(), time.Now(), sql, gorm.ErrRecordNotFound)
+	assert.Equal(t, []string{"error", "debug"}, levels, "should be the debug")
+}
@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	//noTableLabel the table label of the transactions and the sql without the table
+	noTableLabel = "none"
+	//otherTableLabel the table label of the tables neither registered nor allowed
+	otherTableLabel = "other"
+)
+
+var (
+	metricsOnce sync.Once
+
+	metricsLocker sync.RWMutex
+	// the tables allowed as the label besides the registered ones
+	metricsTables = make(map[string]bool)
+
+	queryTotalVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "orm",
+			Subsystem: "query",
+			Name:      "total",
+			Help:      "Total number of orm queries executed",
+		},
+		[]string{"operation", "table", "result"},
+	)
+
+	queryDurationVec = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "orm",
+			Subsystem: "query",
+			Name:      "duration_seconds",
+			Help:      "Latency of the orm queries in seconds",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation", "table", "result"},
+	)
+
+	retryTotalVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "orm",
+			Subsystem: "transaction",
+			Name:      "retries_total",
+			Help:      "Total number of the transaction retries by the SQLSTATE",
+		},
+		[]string{"sqlstate"},
+	)
+)
+
+//RegisterMetrics register the orm collectors into the registerer,
+//the fpm serves the prometheus.DefaultRegisterer at /metrics
+func RegisterMetrics(registerer prometheus.Registerer) {
+	metricsOnce.Do(func() {
+		registerer.MustRegister(queryTotalVec, queryDurationVec, retryTotalVec)
+	})
+}
+
+//SetMetricsTables allow the tables as the table label besides the registered tables,
+//the others are labeled as other to bound the cardinality
+func SetMetricsTables(tables ...string) {
+	metricsLocker.Lock()
+	defer metricsLocker.Unlock()
+	metricsTables = make(map[string]bool)
+	for _, table := range tables {
+		metricsTables[table] = true
+	}
+}
+
+//tableLabel the label of the table: the registered or allowed table, none or other
+func tableLabel(table string) string {
+	if table == "" {
+		return noTableLabel
+	}
+	if _, ok := GetTable(table); ok {
+		return table
+	}
+	metricsLocker.RLock()
+	defer metricsLocker.RUnlock()
+	if metricsTables[table] {
+		return table
+	}
+	return otherTableLabel
+}
+
+//observe record the query of the operation on the table
+func observe(operation, table string, begin time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "fail"
+	}
+	table = tableLabel(table)
+	queryTotalVec.WithLabelValues(operation, table, result).Inc()
+	queryDurationVec.WithLabelValues(operation, table, result).Observe(time.Since(begin).Seconds())
+}
+
+//observeSQL record the raw sql, the table is parsed from the sql
+func observeSQL(operation, sql string, begin time.Time, err error) {
+	_, table := parseStatement(sql)
+	observe(operation, table, begin, err)
+}
@@ -0,0 +1,25 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObserve(t *testing.T) {
+	SetMetricsTables("fake")
+	defer SetMetricsTables()
+	observe("find", "fake", time.Now(), nil)
+	observeSQL("execute", `delete from fake where id = 1`, time.Now(), errors.New("err"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(queryTotalVec.WithLabelValues("find", "fake", "success")), "")
+	assert.Equal(t, float64(1), testutil.ToFloat64(queryTotalVec.WithLabelValues("execute", "fake", "fail")), "")
+
+	others := testutil.ToFloat64(queryTotalVec.WithLabelValues("count", "other", "success"))
+	observe("count", "users_2020_01", time.Now(), nil)
+	assert.Equal(t, others+1, testutil.ToFloat64(queryTotalVec.WithLabelValues("count", "other", "success")), "should bound the tables")
+	assert.Equal(t, "none", tableLabel(""), "")
+}
@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var reColumn = regexp.MustCompile(`^[A-Za-z_][\w.]*$`)
+
+const (
+	//NamingNone the keys are the column names
+	NamingNone = ""
+	//NamingCamel the keys are camelCase, the columns are snake_case
+	NamingCamel = "camel"
+)
+
+//NamingStrategy convert the keys of the biz api and the column names
+type NamingStrategy interface {
+	//Column get the column name of the key
+	Column(key string) string
+
+	//Key get the key of the column name
+	Key(column string) string
+}
+
+//NewNamingStrategy create the naming strategy by the name, none or camel
+func NewNamingStrategy(name string) NamingStrategy {
+	if strings.ToLower(name) == NamingCamel {
+		return &camelNaming{
+			aliases: map[string]string{
+				// compatible with the old keys
+				"createAt": "created_at",
+				"updateAt": "updated_at",
+			},
+		}
+	}
+	return &noneNaming{}
+}
+
+//IsColumn check the name is a plain column like name or t.name
+func IsColumn(name string) bool {
+	return reColumn.MatchString(name)
+}
+
+type noneNaming struct{}
+
+func (n *noneNaming) Column(key string) string {
+	return key
+}
+
+func (n *noneNaming) Key(column string) string {
+	return column
+}
+
+type camelNaming struct {
+	aliases map[string]string
+}
+
+//Column convert userName to user_name, the expressions are kept
+func (n *camelNaming) Column(key string) string {
+	if !IsColumn(key) {
+		return key
+	}
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		if column, ok := n.aliases[part]; ok {
+			parts[i] = column
+			continue
+		}
+		parts[i] = toSnake(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+//Key convert user_name to userName
+func (n *camelNaming) Key(column string) string {
+	return toCamel(column)
+}
+
+func toSnake(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// userID -> user_id, HTTPServer -> http_server
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && runes[i-1] != '_')) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func toCamel(s string) string {
+	parts := strings.Split(s, "_")
+	var b strings.Builder
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if i == 0 || b.Len() == 0 {
+			b.WriteString(part)
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
@@ -0,0 +1,23 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCamelNaming(t *testing.T) {
+	n := NewNamingStrategy(NamingCamel)
+	assert.Equal(t, "user_name", n.Column("userName"), "")
+	assert.Equal(t, "user_id", n.Column("userID"), "")
+	assert.Equal(t, "http_server", n.Column("HTTPServer"), "")
+	assert.Equal(t, "t.user_name", n.Column("t.userName"), "")
+	assert.Equal(t, "created_at", n.Column("createAt"), "should be compatible")
+	assert.Equal(t, "count(1) as c", n.Column("count(1) as c"), "should keep the expression")
+	assert.Equal(t, "userName", n.Key("user_name"), "")
+	assert.Equal(t, "id", n.Key("id"), "")
+
+	n = NewNamingStrategy(NamingNone)
+	assert.Equal(t, "userName", n.Column("userName"), "")
+	assert.Equal(t, "user_name", n.Key("user_name"), "")
+}
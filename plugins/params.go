@@ -0,0 +1,303 @@
+package plugins
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//ParamExecutor run the sql with the parameters, the placeholders are ? for the positional parameters,
+//or :name with a single map or struct argument for the named parameters
+type ParamExecutor interface {
+	ExecuteArgs(sql string, rows *int64, args ...interface{}) error
+
+	//RawArgs the result could be a struct, *map[string]interface{} or *[]map[string]interface{}
+	RawArgs(sql string, result interface{}, args ...interface{}) error
+
+	RawsArgs(sql string, iterator func() interface{}, appender func(interface{}), args ...interface{}) error
+
+	ExecuteArgsContext(ctx context.Context, sql string, rows *int64, args ...interface{}) error
+
+	RawArgsContext(ctx context.Context, sql string, result interface{}, args ...interface{}) error
+
+	RawsArgsContext(ctx context.Context, sql string, iterator func() interface{}, appender func(interface{}), args ...interface{}) error
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.ParamExecutor).ExecuteArgs(`delete from fake where id = ?`, &rows, 11)
+// err = dbclient.(plugins.ParamExecutor).ExecuteArgs(`delete from fake where name = :name`, &rows, map[string]interface{}{"name": "c"})
+func (p *ormImpl) ExecuteArgs(sql string, rows *int64, args ...interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observeSQL("execute", sql, begin, err) }(time.Now())
+	query, args, err := bindParams(sql, args)
+	if err != nil {
+		return
+	}
+	d := p.db.Exec(query, args...)
+	if err = d.Error; err != nil {
+		return
+	}
+	*rows = d.RowsAffected
+	return
+}
+
+//OK
+//Ex:
+// one := make(map[string]interface{})
+// err = dbclient.(plugins.ParamExecutor).RawArgs(`select count(1) as c from fake where id < :id`, &one, map[string]interface{}{"id": 10})
+func (p *ormImpl) RawArgs(sql string, result interface{}, args ...interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observeSQL("raw", sql, begin, err) }(time.Now())
+	query, args, err := bindParams(sql, args)
+	if err != nil {
+		return
+	}
+	raw := p.db.Raw(query, args...)
+	if raw.Error != nil {
+		err = raw.Error
+		return
+	}
+	switch result.(type) {
+	case *map[string]interface{}:
+		one := result.(*map[string]interface{})
+		return p.eachQuery(raw, func(m map[string]interface{}) error {
+			*one = m
+			return ErrStop
+		})
+	case *[]map[string]interface{}:
+		list := result.(*[]map[string]interface{})
+		return p.eachQuery(raw, func(m map[string]interface{}) error {
+			*list = append(*list, m)
+			return nil
+		})
+	}
+	return raw.Scan(result).Error
+}
+
+//OK should be a struct
+//Ex:
+// err = dbclient.(plugins.ParamExecutor).RawsArgs(`select id as c, 1 as b from fake where name = ?`, func() interface{} {
+// 	return &countBody{}
+// }, func(one interface{}) {
+// 	raws = append(raws, one.(*countBody))
+// }, "c")
+func (p *ormImpl) RawsArgs(sql string, iterator func() interface{}, appender func(interface{}), args ...interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observeSQL("raws", sql, begin, err) }(time.Now())
+	query, args, err := bindParams(sql, args)
+	if err != nil {
+		return
+	}
+	d := p.db.Raw(query, args...)
+	raws, err := d.Rows()
+	if err != nil {
+		return
+	}
+	defer raws.Close()
+	for raws.Next() {
+		one := iterator()
+		if err = d.ScanRows(raws, one); err != nil {
+			return
+		}
+		appender(one)
+	}
+
+	return raws.Err()
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.ParamExecutor).ExecuteArgsContext(ctx, `delete from fake where name = :name`, &rows, map[string]interface{}{"name": "c"})
+func (p *ormImpl) ExecuteArgsContext(ctx context.Context, sql string, rows *int64, args ...interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.ExecuteArgs(sql, rows, args...)
+}
+
+//OK
+//Ex:
+// list := make([]map[string]interface{}, 0)
+// err = dbclient.(plugins.ParamExecutor).RawArgsContext(ctx, `select * from fake where value > ?`, &list, 10)
+func (p *ormImpl) RawArgsContext(ctx context.Context, sql string, result interface{}, args ...interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.RawArgs(sql, result, args...)
+}
+
+//OK should be a struct
+//Ex:
+// err = dbclient.(plugins.ParamExecutor).RawsArgsContext(ctx, `select id as c from fake where name = :name`, func() interface{} {
+// 	return &countBody{}
+// }, func(one interface{}) {
+// 	raws = append(raws, one.(*countBody))
+// }, map[string]interface{}{"name": "c"})
+func (p *ormImpl) RawsArgsContext(ctx context.Context, sql string, iterator func() interface{}, appender func(interface{}), args ...interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.RawsArgs(sql, iterator, appender, args...)
+}
+
+//bindParams replace the :name of the sql with ? if the args is a single map or struct,
+//the ::type casts, the arr[a:b] slices, the quoted or $tag$ quoted strings and the comments are kept.
+//The sql without the :name keeps the args positional, like a map bound to a jsonb ?
+func bindParams(sql string, args []interface{}) (string, []interface{}, error) {
+	if len(args) != 1 {
+		return sql, args, nil
+	}
+	values, ok := namedValues(args[0])
+	if !ok {
+		return sql, args, nil
+	}
+	runes := []rune(sql)
+	var b strings.Builder
+	bound := make([]interface{}, 0)
+	named := false
+	quote := rune(0)
+	// the depth of the [] of the array subscripts
+	brackets := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			// the comment till the end of the line
+			j := i
+			for j < len(runes) && runes[j] != '\n' {
+				j++
+			}
+			b.WriteString(string(runes[i:j]))
+			i = j - 1
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			j := blockCommentEnd(runes, i)
+			b.WriteString(string(runes[i:j]))
+			i = j - 1
+			continue
+		case r == '$' && (i == 0 || !isIdentRune(runes[i-1])):
+			j := dollarQuoteEnd(runes, i)
+			b.WriteString(string(runes[i:j]))
+			i = j - 1
+			continue
+		case r == '[':
+			brackets++
+		case r == ']' && brackets > 0:
+			brackets--
+		case r == ':' && brackets > 0:
+			// the slice of the array
+		case r == ':' && i+1 < len(runes) && runes[i+1] == ':':
+			// the cast
+			b.WriteString("::")
+			i++
+			continue
+		case r == ':' && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || runes[i+1] == '_'):
+			j := i + 1
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			name := string(runes[i+1 : j])
+			named = true
+			v, exists := values[name]
+			if !exists {
+				return "", nil, Invalidf("INVALID_PARAM: %s required", name)
+			}
+			b.WriteRune('?')
+			bound = append(bound, normalizeValue(v))
+			i = j - 1
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if !named {
+		return sql, args, nil
+	}
+	return b.String(), bound, nil
+}
+
+//blockCommentEnd the index after the /* */ comment at the i, the comments could be nested
+func blockCommentEnd(runes []rune, i int) int {
+	depth := 0
+	for j := i; j+1 < len(runes); j++ {
+		switch {
+		case runes[j] == '/' && runes[j+1] == '*':
+			depth++
+			j++
+		case runes[j] == '*' && runes[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(runes)
+}
+
+//dollarQuoteEnd the index after the $$ or $tag$ quoted string at the i,
+//the i+1 for the $ not quoting, like the $1
+func dollarQuoteEnd(runes []rune, i int) int {
+	j := i + 1
+	for j < len(runes) && runes[j] != '$' {
+		if !isIdentRune(runes[j]) || (j == i+1 && unicode.IsDigit(runes[j])) {
+			return i + 1
+		}
+		j++
+	}
+	if j >= len(runes) {
+		return i + 1
+	}
+	n := j + 1 - i
+	tag := string(runes[i : j+1])
+	for k := j + 1; k+n <= len(runes); k++ {
+		if string(runes[k:k+n]) == tag {
+			return k + n
+		}
+	}
+	return len(runes)
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+//namedValues get the named values of the map or the struct, the fields of the struct are named by
+//the json tag, the snake_case and the field name
+func namedValues(arg interface{}) (values map[string]interface{}, ok bool) {
+	switch arg.(type) {
+	case map[string]interface{}:
+		return arg.(map[string]interface{}), true
+	case db.CommonMap:
+		return arg.(db.CommonMap), true
+	case time.Time, *time.Time:
+		return nil, false
+	}
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	values = make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		value := v.Field(i).Interface()
+		values[field.Name] = value
+		values[toSnake(field.Name)] = value
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" && tag != "-" {
+			values[tag] = value
+		}
+	}
+	return values, true
+}
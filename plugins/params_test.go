@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	stdsql "database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindParams(t *testing.T) {
+	sql, args, err := bindParams(`select id::text, ':skip' as s from fake where name = :name and value > :min_value`,
+		[]interface{}{map[string]interface{}{"name": "c", "min_value": float64(1)}})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `select id::text, ':skip' as s from fake where name = ? and value > ?`, sql, "")
+	assert.Equal(t, []interface{}{"c", int64(1)}, args, "")
+
+	type filter struct {
+		Name     string `json:"name"`
+		MinValue int
+	}
+	sql, args, err = bindParams(`select * from fake where name = :name and value > :min_value`, []interface{}{&filter{Name: "c", MinValue: 1}})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `select * from fake where name = ? and value > ?`, sql, "")
+	assert.Equal(t, []interface{}{"c", 1}, args, "")
+
+	// positional
+	sql, args, err = bindParams(`select * from fake where name = ?`, []interface{}{"c"})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `select * from fake where name = ?`, sql, "")
+	assert.Equal(t, []interface{}{"c"}, args, "")
+
+	// the single map or struct without the :name is positional
+	meta := map[string]interface{}{"a": 1}
+	sql, args, err = bindParams(`update fake set meta = ?::jsonb where name = 'a:b'`, []interface{}{meta})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `update fake set meta = ?::jsonb where name = 'a:b'`, sql, "")
+	assert.Equal(t, []interface{}{meta}, args, "should keep the map")
+	name := stdsql.NullString{String: "c", Valid: true}
+	_, args, err = bindParams(`select * from fake where name = ? -- :name`, []interface{}{name})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, []interface{}{name}, args, "should keep the struct")
+
+	_, _, err = bindParams(`select * from fake where name = :name`, []interface{}{map[string]interface{}{}})
+	assert.NotNil(t, err, "should err on the missing param")
+}
+
+func TestBindParamsSkip(t *testing.T) {
+	values := []interface{}{map[string]interface{}{"name": "c", "lo": 1, "hi": 2}}
+	cases := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"block comment", `select * /* :lo, /* nested :hi */ */ from fake where name = :name`,
+			`select * /* :lo, /* nested :hi */ */ from fake where name = ?`},
+		{"dollar quote", `select $$it's :lo$$ as s from fake where name = :name`,
+			`select $$it's :lo$$ as s from fake where name = ?`},
+		{"tagged dollar quote", `select $fn$ :lo $$ :hi $fn$ as s from fake where name = :name`,
+			`select $fn$ :lo $$ :hi $fn$ as s from fake where name = ?`},
+		{"array slice", `select tags[lo:hi], tags[1:2] from fake where name = :name`,
+			`select tags[lo:hi], tags[1:2] from fake where name = ?`},
+		{"positional", `select $1::text as s from fake where name = :name`,
+			`select $1::text as s from fake where name = ?`},
+	}
+	for _, c := range cases {
+		sql, args, err := bindParams(c.sql, values)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, c.want, sql, c.name)
+		assert.Equal(t, []interface{}{"c"}, args, c.name)
+	}
+}
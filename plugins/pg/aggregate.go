@@ -0,0 +1,78 @@
+package pg
+
+import (
+	"strings"
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+)
+
+type aggregateReq struct {
+	GroupBy    interface{}     `json:"groupBy,omitempty"`
+	Aggregates []aggregateItem `json:"aggregates,omitempty"`
+	Having     []havingItem    `json:"having,omitempty"`
+}
+
+type aggregateItem struct {
+	Func  string `json:"func"`
+	Field string `json:"field"`
+	As    string `json:"as"`
+}
+
+type havingItem struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+//parseAggregateFromBizParam parse the aggregate query, the condition, sort and pager are the same as the find
+func parseAggregateFromBizParam(param *fpm.BizParam) (q *plugins.AggregateQuery, err error) {
+	req := aggregateReq{}
+	if err = param.Convert(&req); err != nil {
+		return
+	}
+	q = plugins.NewAggregateQuery()
+	if q.QueryData, err = parseQueryFromBizParam(param); err != nil {
+		return
+	}
+
+	switch req.GroupBy.(type) {
+	case string:
+		for _, g := range strings.Split(req.GroupBy.(string), ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				q.GroupBy = append(q.GroupBy, naming.Column(g))
+			}
+		}
+	case []interface{}:
+		for _, g := range req.GroupBy.([]interface{}) {
+			if s, ok := g.(string); ok {
+				q.GroupBy = append(q.GroupBy, naming.Column(s))
+			}
+		}
+	}
+
+	for _, a := range req.Aggregates {
+		alias := a.As
+		if alias == "" {
+			// count, sum_value
+			alias = strings.ToLower(a.Func)
+			if a.Field != "" && a.Field != "*" {
+				alias += "_" + a.Field
+			}
+		}
+		q.Aggregates = append(q.Aggregates, plugins.Aggregate{
+			Func:  a.Func,
+			Field: naming.Column(a.Field),
+			Alias: naming.Column(alias),
+		})
+	}
+
+	for _, h := range req.Having {
+		q.Having = append(q.Having, plugins.Having{
+			Alias:    naming.Column(h.Field),
+			Operator: h.Op,
+			Value:    h.Value,
+		})
+	}
+	return
+}
@@ -0,0 +1,201 @@
+package pg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//reReference the reference to the result of the earlier operation: ${order.id}, ${0.id}
+var reReference = regexp.MustCompile(`^\$\{(\w+)((?:\.\w+)*)\}$`)
+
+type batchReq struct {
+	Operations []map[string]interface{} `json:"operations,omitempty"`
+}
+
+type batchOperation struct {
+	queryReq
+	// create, update, remove, find
+	Op string `json:"op"`
+	// the name of the result for the references
+	As string `json:"as"`
+}
+
+//runBatch run the operations in order on the tx, the results are:
+//the created row with the id, {rows} of the update and remove, the list of the find
+func runBatch(tx db.Database, operations []map[string]interface{}) (results []interface{}, err error) {
+	results = make([]interface{}, 0, len(operations))
+	refs := make(map[string]interface{})
+	for i, raw := range operations {
+		var resolved interface{}
+		if resolved, err = resolveReferences(raw, refs); err != nil {
+			return nil, fmt.Errorf("BATCH_FAILED: operation %d: %w", i, err)
+		}
+		op := batchOperation{}
+		if err = bindOperation(resolved, &op); err != nil {
+			return nil, fmt.Errorf("BATCH_FAILED: operation %d: %w", i, err)
+		}
+		var result interface{}
+		if result, err = runOperation(tx, &op); err != nil {
+			return nil, fmt.Errorf("BATCH_FAILED: operation %d %s: %w", i, op.Op, err)
+		}
+		results = append(results, result)
+		refs[strconv.Itoa(i)] = result
+		if op.As != "" {
+			refs[op.As] = result
+		}
+	}
+	return
+}
+
+func runOperation(tx db.Database, op *batchOperation) (result interface{}, err error) {
+	q, err := parseQuery(&op.queryReq)
+	if err != nil {
+		return
+	}
+	var rows int64
+	switch op.Op {
+	case "create":
+		row, ok := op.Data.(map[string]interface{})
+		if !ok {
+			return nil, plugins.Invalidf("INVALID_BATCH: row required")
+		}
+		row = toColumns(row)
+		if err = tx.Create(q.BaseData, &row); err != nil {
+			return
+		}
+		return toKeys(row), nil
+	case "update":
+		cm, ok := op.Data.(map[string]interface{})
+		if !ok {
+			return nil, plugins.Invalidf("INVALID_BATCH: row required")
+		}
+		if op.Version != nil {
+			// the optimistic locking like the common.update
+			var next interface{}
+			if err = tx.(plugins.VersionUpdater).UpdatesVersion(q.BaseData, toColumns(cm), op.Version, &rows, &next); err != nil {
+				return
+			}
+			return map[string]interface{}{"rows": rows, "version": next}, nil
+		}
+		if err = tx.Updates(q.BaseData, toColumns(cm), &rows); err != nil {
+			return
+		}
+		return map[string]interface{}{"rows": rows}, nil
+	case "remove":
+		if err = tx.Remove(q.BaseData, &rows); err != nil {
+			return
+		}
+		return map[string]interface{}{"rows": rows}, nil
+	case "find":
+		list := make([]map[string]interface{}, 0)
+		if err = tx.Find(q, &list); err != nil {
+			return
+		}
+		return toKeysList(list), nil
+	}
+	return nil, plugins.Invalidf("INVALID_BATCH: op %s", op.Op)
+}
+
+//bindOperation bind the resolved operation, the numbers are decoded exactly, the referenced bigint ids are kept
+func bindOperation(resolved interface{}, op *batchOperation) (err error) {
+	raw, err := json.Marshal(resolved)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err = decoder.Decode(op); err != nil {
+		return
+	}
+	op.Condition = exactNumbers(op.Condition)
+	op.Data = exactNumbers(op.Data)
+	op.ID = exactNumbers(op.ID)
+	op.Sort = exactNumbers(op.Sort)
+	op.Version = exactNumbers(op.Version)
+	return
+}
+
+//exactNumbers convert the json.Number to int64, or float64 if it's not a int
+func exactNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, one := range val {
+			val[k] = exactNumbers(one)
+		}
+	case []interface{}:
+		for i, one := range val {
+			val[i] = exactNumbers(one)
+		}
+	}
+	return v
+}
+
+//resolveReferences replace the ${name.path} strings with the values of the results
+func resolveReferences(v interface{}, refs map[string]interface{}) (interface{}, error) {
+	switch v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v.(map[string]interface{})))
+		for k, one := range v.(map[string]interface{}) {
+			resolved, err := resolveReferences(one, refs)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = resolved
+		}
+		return m, nil
+	case []interface{}:
+		list := make([]interface{}, len(v.([]interface{})))
+		for i, one := range v.([]interface{}) {
+			resolved, err := resolveReferences(one, refs)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = resolved
+		}
+		return list, nil
+	case string:
+		matches := reReference.FindStringSubmatch(v.(string))
+		if matches == nil {
+			return v, nil
+		}
+		value, ok := refs[matches[1]]
+		if !ok {
+			return nil, plugins.Invalidf("INVALID_REFERENCE: %s", v)
+		}
+		for _, key := range strings.Split(strings.TrimPrefix(matches[2], "."), ".") {
+			if key == "" {
+				continue
+			}
+			switch value.(type) {
+			case map[string]interface{}:
+				if value, ok = value.(map[string]interface{})[key]; !ok {
+					return nil, plugins.Invalidf("INVALID_REFERENCE: %s", v)
+				}
+			case []map[string]interface{}:
+				list := value.([]map[string]interface{})
+				i, e := strconv.Atoi(key)
+				if e != nil || i < 0 || i >= len(list) {
+					return nil, plugins.Invalidf("INVALID_REFERENCE: %s", v)
+				}
+				value = list[i]
+			default:
+				return nil, plugins.Invalidf("INVALID_REFERENCE: %s", v)
+			}
+		}
+		return value, nil
+	}
+	return v, nil
+}
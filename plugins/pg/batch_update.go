@@ -0,0 +1,41 @@
+package pg
+
+import (
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+type batchUpdateReq struct {
+	Table string           `json:"table,omitempty"`
+	Rows  []batchUpdateRow `json:"rows,omitempty"`
+}
+
+type batchUpdateRow struct {
+	ID      interface{}            `json:"id"`
+	Changes map[string]interface{} `json:"changes"`
+}
+
+//parseBatchUpdateFromBizParam parse the changes of the rows, the condition is applied to all the rows
+func parseBatchUpdateFromBizParam(param *fpm.BizParam) (q *db.QueryData, list []plugins.RowChanges, err error) {
+	req := batchUpdateReq{}
+	if err = param.Convert(&req); err != nil {
+		return
+	}
+	if len(req.Rows) == 0 {
+		err = plugins.Invalidf("INVALID_BATCH_UPDATE: rows required")
+		return
+	}
+	if q, err = parseQueryFromBizParam(param); err != nil {
+		return
+	}
+	list = make([]plugins.RowChanges, 0, len(req.Rows))
+	for _, row := range req.Rows {
+		list = append(list, plugins.RowChanges{
+			ID:      row.ID,
+			Changes: toColumns(row.Changes),
+		})
+	}
+	return
+}
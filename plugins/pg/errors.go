@@ -0,0 +1,35 @@
+package pg
+
+import (
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/errno"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+)
+
+//bizError convert the mapped database failure to the errno of the negative http status: -404, -409, -504...,
+//the others are returned as is, the fpm responds them with the default errno
+func bizError(err error) error {
+	code := plugins.ErrorCodeOf(err)
+	if code == "" || code == plugins.CodeUnknown {
+		return err
+	}
+	return errno.New(-code.Status(), err.Error())
+}
+
+//withBizError the handler responds the errno of the database failures
+func withBizError(handler fpm.BizHandler) fpm.BizHandler {
+	return func(param *fpm.BizParam) (data interface{}, err error) {
+		if data, err = handler(param); err != nil {
+			return nil, bizError(err)
+		}
+		return
+	}
+}
+
+//emptyIfNotFound ignore the NOT_FOUND error of the first and get, they respond {} unless the notFoundError enabled
+func emptyIfNotFound(err error) error {
+	if !option.NotFoundError && plugins.ErrorCodeOf(err) == plugins.CodeNotFound {
+		return nil
+	}
+	return err
+}
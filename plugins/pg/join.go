@@ -0,0 +1,89 @@
+package pg
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+type joinReq struct {
+	Joins   []joinItem  `json:"joins,omitempty"`
+	Include interface{} `json:"include,omitempty"`
+}
+
+type joinItem struct {
+	Type  string            `json:"type"`
+	Table string            `json:"table"`
+	As    string            `json:"as"`
+	On    map[string]string `json:"on"`
+}
+
+//parseJoinFromBizParam parse the joins and the includes of the find, nil if none of them
+func parseJoinFromBizParam(param *fpm.BizParam, q *db.QueryData) (jq *plugins.JoinQuery, err error) {
+	req := joinReq{}
+	if err = param.Convert(&req); err != nil {
+		return
+	}
+	includes := make([]string, 0)
+	switch req.Include.(type) {
+	case string:
+		for _, name := range strings.Split(req.Include.(string), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				includes = append(includes, name)
+			}
+		}
+	case []interface{}:
+		for _, name := range req.Include.([]interface{}) {
+			if s, ok := name.(string); ok {
+				includes = append(includes, s)
+			}
+		}
+	}
+	if len(req.Joins) == 0 && len(includes) == 0 {
+		return
+	}
+
+	jq = plugins.NewJoinQuery()
+	jq.QueryData = q
+	jq.Includes = includes
+	for _, j := range req.Joins {
+		join := plugins.Join{
+			Type:  j.Type,
+			Table: j.Table,
+			Alias: j.As,
+			On:    make([]plugins.JoinOn, 0, len(j.On)),
+		}
+		lefts := make([]string, 0, len(j.On))
+		for left := range j.On {
+			lefts = append(lefts, left)
+		}
+		sort.Strings(lefts)
+		for _, left := range lefts {
+			join.On = append(join.On, plugins.JoinOn{
+				Left:  naming.Column(left),
+				Right: naming.Column(j.On[left]),
+			})
+		}
+		jq.Joins = append(jq.Joins, join)
+	}
+	return
+}
+
+//toKeysIncludes convert the column names of the results and the included rows to the keys
+func toKeysIncludes(list []map[string]interface{}, includes []string) []map[string]interface{} {
+	for i, row := range list {
+		for _, name := range includes {
+			switch row[name].(type) {
+			case []map[string]interface{}:
+				row[name] = toKeysList(row[name].([]map[string]interface{}))
+			case map[string]interface{}:
+				row[name] = toKeys(row[name].(map[string]interface{}))
+			}
+		}
+		list[i] = toKeys(row)
+	}
+	return list
+}
@@ -0,0 +1,39 @@
+package pg
+
+import (
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+)
+
+//naming the naming strategy of the keys of the common biz
+var naming = plugins.NewNamingStrategy(plugins.NamingNone)
+
+//legacyKeys the keys are not converted by the naming strategy, the createAt/updateAt fields are expanded to the epoch millis
+func legacyKeys() bool {
+	return naming.Column("createAt") == "createAt"
+}
+
+//toColumns convert the keys of the row data to the column names
+func toColumns(row map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		m[naming.Column(k)] = v
+	}
+	return m
+}
+
+//toKeys convert the column names of the result to the keys
+func toKeys(row map[string]interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		m[naming.Key(k)] = v
+	}
+	return m
+}
+
+//toKeysList convert the column names of the results to the keys
+func toKeysList(list []map[string]interface{}) []map[string]interface{} {
+	for i, row := range list {
+		list[i] = toKeys(row)
+	}
+	return list
+}
@@ -1,12 +1,15 @@
 package pg
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"strings"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/team4yf/fpm-go-pkg/utils"
 
 	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/ctx"
 	"github.com/team4yf/yf-fpm-server-go/fpm"
 	"github.com/team4yf/yf-fpm-server-go/pkg/db"
 )
@@ -19,7 +22,63 @@ type queryReq struct {
 	Limit     int         `json:"limit,omitempty"`
 	Data      interface{} `json:"row,omitempty"`
 	ID        interface{} `json:"id,omitempty"`
-	Sort      string      `json:"sort,omitempty"`
+	Sort      interface{} `json:"sort,omitempty"`
+	Cursor    *string     `json:"cursor,omitempty"`
+	// match the soft-deleted rows too
+	WithDeleted bool `json:"withDeleted,omitempty"`
+	// match the soft-deleted rows only
+	OnlyDeleted bool `json:"onlyDeleted,omitempty"`
+	// the version of the optimistic locking for the update
+	Version interface{} `json:"version,omitempty"`
+}
+
+type namedQueryReq struct {
+	Name   string                 `json:"name,omitempty"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+//contextKey the key of the request context in the BizParam
+const contextKey = "__ctx__"
+
+//requestContext hold the context in the BizParam, it's marshaled as {}
+type requestContext struct {
+	ctx context.Context
+}
+
+//SetContext put the ctx into the param, the common.* handlers query with it
+func SetContext(param *fpm.BizParam, ctx context.Context) {
+	(*param)[contextKey] = &requestContext{ctx: ctx}
+}
+
+//bizContext get the context from the param, default context.Background()
+func bizContext(param *fpm.BizParam) context.Context {
+	if rc, ok := (*param)[contextKey].(*requestContext); ok && rc.ctx != nil {
+		return rc.ctx
+	}
+	return context.Background()
+}
+
+//contextFilter pass the context of the http request to the biz handlers
+func contextFilter(_ *fpm.Fpm, _ string, args *fpm.BizParam, c *ctx.Ctx) (bool, interface{}, error) {
+	if c != nil && c.GetRequest() != nil {
+		SetContext(args, c.GetRequest().Context())
+	}
+	return true, nil, nil
+}
+
+//scopedClient get the client of the soft-delete scope of the param: withDeleted or onlyDeleted
+func scopedClient(client plugins.ContextDatabase, param *fpm.BizParam) plugins.ContextDatabase {
+	req := queryReq{}
+	if err := param.Convert(&req); err != nil {
+		return client
+	}
+	switch {
+	case req.OnlyDeleted:
+		return client.(plugins.SoftDeleter).OnlyDeleted().(plugins.ContextDatabase)
+	case req.WithDeleted:
+		return client.(plugins.SoftDeleter).WithDeleted().(plugins.ContextDatabase)
+	}
+	return client
 }
 
 func parseQueryFromBizParam(param *fpm.BizParam) (q *db.QueryData, err error) {
@@ -28,11 +87,10 @@ func parseQueryFromBizParam(param *fpm.BizParam) (q *db.QueryData, err error) {
 		return
 	}
 
-	q = parseQuery(&queryReq)
-	return
+	return parseQuery(&queryReq)
 }
 
-func parseQuery(req *queryReq) *db.QueryData {
+func parseQuery(req *queryReq) (*db.QueryData, error) {
 	q := db.NewQuery()
 	q.SetTable(req.Table)
 	if req.Limit != 0 {
@@ -43,10 +101,16 @@ func parseQuery(req *queryReq) *db.QueryData {
 	}
 
 	if req.Fields != "" {
-		//TODO： 这里尚未考虑到兼容性
-		f := strings.ReplaceAll(req.Fields, "updateAt", "updated_at,(floor(extract(epoch from updated_at) *1000)::bigint) as updateAt")
-		f = strings.ReplaceAll(f, "createAt", "created_at,(floor(extract(epoch from created_at) *1000)::bigint) as createAt")
-		q.AddFields((strings.Split(f, ","))...)
+		if legacyKeys() {
+			//TODO： 这里尚未考虑到兼容性
+			f := strings.ReplaceAll(req.Fields, "updateAt", "updated_at,(floor(extract(epoch from updated_at) *1000)::bigint) as updateAt")
+			f = strings.ReplaceAll(f, "createAt", "created_at,(floor(extract(epoch from created_at) *1000)::bigint) as createAt")
+			q.AddFields((strings.Split(f, ","))...)
+		} else {
+			for _, f := range strings.Split(req.Fields, ",") {
+				q.AddFields(naming.Column(strings.TrimSpace(f)))
+			}
+		}
 	}
 	if req.Condition != nil {
 		switch req.Condition.(type) {
@@ -57,12 +121,16 @@ func parseQuery(req *queryReq) *db.QueryData {
 			keys := make([]string, 0)
 			vals := make([]interface{}, 0)
 			for k, v := range conditions {
-				keys = append(keys, k+" = ?")
+				column := naming.Column(k)
+				if !plugins.IsColumn(column) {
+					return nil, plugins.Invalidf("INVALID_CONDITION: %s", k)
+				}
+				keys = append(keys, column+" = ?")
 				vals = append(vals, v)
 			}
-			q.SetCondition(strings.Join(keys, ","), vals...)
+			q.SetCondition(strings.Join(keys, " and "), vals...)
 		default:
-			fmt.Printf("what? %v\n", req.Condition)
+			return nil, plugins.Invalidf("INVALID_CONDITION: %v", req.Condition)
 		}
 
 	}
@@ -73,59 +141,135 @@ func parseQuery(req *queryReq) *db.QueryData {
 			q.SetCondition("id = ?", (int64)(req.ID.(float64)))
 		case int64:
 			q.SetCondition("id = ?", req.ID.(int64))
+		case int:
+			q.SetCondition("id = ?", int64(req.ID.(int)))
 		default:
 			q.SetCondition("id = ?", req.ID)
 		}
 
 	}
 
-	if req.Sort != "" {
+	sorters, err := parseSort(req.Sort)
+	if err != nil {
+		return nil, err
+	}
+	q.AddSorter(sorters...)
 
-		l := len(req.Sort)
-		asc := "asc"
-		sortBy := "id"
-		lastLetter := req.Sort[l-1:]
-		if lastLetter == "-" {
-			asc = "desc"
-		}
+	return q, nil
+}
 
-		if lastLetter != "-" && lastLetter != "+" {
-			sortBy = req.Sort
-		} else {
-			sortBy = req.Sort[0 : l-1]
-		}
-		q.AddSorter(db.Sorter{
-			Sortby: sortBy,
-			Asc:    asc,
-		})
+//hasFilter the condition or the id given, or the default 1=1 matches all the rows
+func hasFilter(req *queryReq) bool {
+	if req.ID != nil {
+		return true
+	}
+	switch condition := req.Condition.(type) {
+	case string:
+		return strings.TrimSpace(condition) != ""
+	case map[string]interface{}:
+		return len(condition) > 0
 	}
+	return false
+}
 
-	return q
+//parseFilteredQuery parse the query of the restore or the destroy, which requires the condition or the id
+func parseFilteredQuery(param *fpm.BizParam, op string) (*db.QueryData, error) {
+	req := queryReq{}
+	if err := param.Convert(&req); err != nil {
+		return nil, err
+	}
+	if !hasFilter(&req) {
+		return nil, plugins.Invalidf("INVALID_%s: condition or id required", op)
+	}
+	return parseQuery(&req)
 }
+
+//columnValues the values of the single column rows, the key is the result column, like name of the t.name
+func columnValues(list []map[string]interface{}) []interface{} {
+	values := make([]interface{}, len(list))
+	for i, row := range list {
+		for _, v := range row {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+//option the setting of the db
+var option = &plugins.DBSetting{}
+
 func init() {
 	fpm.Register(func(app *fpm.Fpm) {
-		option := &plugins.DBSetting{}
 		if err := app.FetchConfig("db", &option); err != nil {
 			panic(err)
 		}
+		naming = plugins.NewNamingStrategy(option.Naming)
+		for table, relations := range option.Relations {
+			for name, relation := range relations {
+				plugins.RegisterRelation(table, name, relation)
+			}
+		}
+		for table, tableOption := range option.Tables {
+			plugins.RegisterTable(table, tableOption)
+		}
+		plugins.SetMetricsTables(option.MetricsTables...)
+		queryDir := option.Queries
+		if queryDir == "" {
+			queryDir = "queries"
+		}
+		if err := plugins.LoadQueries(queryDir); err != nil {
+			panic(err)
+		}
+		option.Logger = app.Logger
 		dbInstance := plugins.New(option)
-		dbclient := plugins.NewImpl(dbInstance)
+		plugins.RegisterMetrics(prometheus.DefaultRegisterer)
+		dbclient := plugins.NewImplWithSetting(dbInstance, option).(plugins.ContextDatabase)
 		app.SetDatabase("pg", func() db.Database {
 			return dbclient
 		})
 		bizModule := make(fpm.BizModule, 0)
 
 		// support:
-		// 1. x 'find', x 'first', 'create', 'update', x 'remove', x 'clear', x 'get', x 'count', x 'findAndCount'
+		// 1. x 'find', x 'first', 'create', 'update', x 'remove', x 'clear', x 'get', x 'count', x 'findAndCount', x 'aggregate', x 'distinct', x 'restore', x 'destroy', x 'upsert', x 'batchUpdate', x 'query', x 'batch'
 
 		bizModule["find"] = func(param *fpm.BizParam) (data interface{}, err error) {
-			q, err := parseQueryFromBizParam(param)
+			req := queryReq{}
+			if err = param.Convert(&req); err != nil {
+				return
+			}
+			q, err := parseQuery(&req)
 			if err != nil {
 				return nil, err
 			}
 			list := make([]map[string]interface{}, 0)
-			err = dbclient.Find(q, &list)
-			data = &list
+			jq, err := parseJoinFromBizParam(param, q)
+			if err != nil {
+				return nil, err
+			}
+			if jq != nil {
+				if req.Cursor != nil {
+					return nil, plugins.Invalidf("INVALID_CURSOR: not supported with joins")
+				}
+				err = scopedClient(dbclient, param).(plugins.Joiner).FindJoinContext(bizContext(param), jq, &list)
+				list = toKeysIncludes(list, jq.Includes)
+				data = &list
+				return
+			}
+			if req.Cursor == nil {
+				err = scopedClient(dbclient, param).FindContext(bizContext(param), q, &list)
+				list = toKeysList(list)
+				data = &list
+				return
+			}
+			// keyset pagination
+			nextCursor := ""
+			if err = scopedClient(dbclient, param).(plugins.CursorFinder).FindCursorContext(bizContext(param), q, *req.Cursor, &list, &nextCursor); err != nil {
+				return
+			}
+			data = map[string]interface{}{
+				"rows":       toKeysList(list),
+				"nextCursor": nextCursor,
+			}
 			return
 		}
 
@@ -136,11 +280,11 @@ func init() {
 			}
 			list := make([]map[string]interface{}, 0)
 			var total int64
-			err = dbclient.FindAndCount(q, &list, &total)
+			err = scopedClient(dbclient, param).FindAndCountContext(bizContext(param), q, &list, &total)
 
 			data = map[string]interface{}{
 				"count": total,
-				"rows":  list,
+				"rows":  toKeysList(list),
 			}
 			return
 		}
@@ -151,18 +295,50 @@ func init() {
 				return nil, err
 			}
 			var total int64
-			err = dbclient.Count(q.BaseData, &total)
+			err = scopedClient(dbclient, param).CountContext(bizContext(param), q.BaseData, &total)
 			data = total
 			return
 		}
 
+		bizModule["aggregate"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			q, err := parseAggregateFromBizParam(param)
+			if err != nil {
+				return nil, err
+			}
+			list := make([]map[string]interface{}, 0)
+			err = scopedClient(dbclient, param).(plugins.Aggregator).AggregateContext(bizContext(param), q, &list)
+			list = toKeysList(list)
+			data = &list
+			return
+		}
+
+		bizModule["distinct"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			q, err := parseQueryFromBizParam(param)
+			if err != nil {
+				return nil, err
+			}
+			list := make([]map[string]interface{}, 0)
+			if err = scopedClient(dbclient, param).(plugins.DistinctFinder).DistinctContext(bizContext(param), q, &list); err != nil {
+				return
+			}
+			if len(q.Fields) > 1 {
+				list = toKeysList(list)
+				data = &list
+				return
+			}
+			values := columnValues(list)
+			data = &values
+			return
+		}
+
 		bizModule["first"] = func(param *fpm.BizParam) (data interface{}, err error) {
 			q, err := parseQueryFromBizParam(param)
 			if err != nil {
 				return nil, err
 			}
 			one := make(map[string]interface{})
-			err = dbclient.First(q, &one)
+			err = emptyIfNotFound(scopedClient(dbclient, param).FirstContext(bizContext(param), q, &one))
+			one = toKeys(one)
 			data = &one
 			return
 		}
@@ -172,10 +348,14 @@ func init() {
 			if err = param.Convert(&req); err != nil {
 				return
 			}
-			q := parseQuery(&req)
+			q, err := parseQuery(&req)
+			if err != nil {
+				return nil, err
+			}
 			q.SetCondition("id = ?", req.ID)
 			one := make(map[string]interface{})
-			err = dbclient.First(q, &one)
+			err = emptyIfNotFound(scopedClient(dbclient, param).FirstContext(bizContext(param), q, &one))
+			one = toKeys(one)
 			data = &one
 			return
 		}
@@ -186,9 +366,12 @@ func init() {
 				return
 			}
 
-			q := parseQuery(&req)
+			q, err := parseQuery(&req)
+			if err != nil {
+				return nil, err
+			}
 			var rows int64
-			err = dbclient.Remove(q.BaseData, &rows)
+			err = dbclient.RemoveContext(bizContext(param), q.BaseData, &rows)
 			data = rows
 			return
 		}
@@ -199,31 +382,120 @@ func init() {
 				return nil, err
 			}
 			var rows int64
-			err = dbclient.Remove(q.BaseData, &rows)
+			err = dbclient.RemoveContext(bizContext(param), q.BaseData, &rows)
 			data = rows
 			return
 		}
 
+		bizModule["restore"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			q, err := parseFilteredQuery(param, "RESTORE")
+			if err != nil {
+				return nil, err
+			}
+			var rows int64
+			err = dbclient.(plugins.SoftDeleter).RestoreContext(bizContext(param), q.BaseData, &rows)
+			data = rows
+			return
+		}
+
+		bizModule["destroy"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			if !option.AllowDestroy {
+				return nil, errors.New("DESTROY_NOT_ALLOWED: set db.allowDestroy to enable it")
+			}
+			q, err := parseFilteredQuery(param, "DESTROY")
+			if err != nil {
+				return nil, err
+			}
+			var rows int64
+			err = dbclient.(plugins.SoftDeleter).DestroyContext(bizContext(param), q.BaseData, &rows)
+			data = rows
+			return
+		}
+
+		bizModule["query"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			req := namedQueryReq{}
+			if err = param.Convert(&req); err != nil {
+				return
+			}
+			list := make([]map[string]interface{}, 0)
+			err = dbclient.(plugins.QueryRunner).RunQueryContext(bizContext(param), req.Name, req.Params, &list)
+			list = toKeysList(list)
+			data = &list
+			return
+		}
+
 		bizModule["create"] = func(param *fpm.BizParam) (data interface{}, err error) {
 			req := queryReq{}
 			if err = param.Convert(&req); err != nil {
 				return
 			}
 
-			q := parseQuery(&req)
+			q, err := parseQuery(&req)
+			if err != nil {
+				return nil, err
+			}
 			q.SetTable(req.Table)
-			err = dbclient.Create(q.BaseData, req.Data)
+			if row, ok := req.Data.(map[string]interface{}); ok {
+				req.Data = toColumns(row)
+			}
+			err = dbclient.CreateContext(bizContext(param), q.BaseData, req.Data)
 			data = 1
 			return
 		}
 
+		bizModule["upsert"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			req, list, upsertOption, err := parseUpsertFromBizParam(param)
+			if err != nil {
+				return nil, err
+			}
+			q := db.NewQuery()
+			q.SetTable(req.Table)
+			var rows int64
+			err = dbclient.(plugins.Upserter).UpsertContext(bizContext(param), q.BaseData, list, upsertOption, &rows)
+			data = rows
+			return
+		}
+
+		bizModule["batchUpdate"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			q, list, err := parseBatchUpdateFromBizParam(param)
+			if err != nil {
+				return nil, err
+			}
+			results := make([]plugins.RowResult, 0)
+			err = dbclient.(plugins.BatchUpdater).BatchUpdateContext(bizContext(param), q.BaseData, list, &results)
+			data = &results
+			return
+		}
+
+		bizModule["batch"] = func(param *fpm.BizParam) (data interface{}, err error) {
+			req := batchReq{}
+			if err = param.Convert(&req); err != nil {
+				return
+			}
+			if len(req.Operations) == 0 {
+				return nil, plugins.Invalidf("INVALID_BATCH: operations required")
+			}
+			var results []interface{}
+			if err = dbclient.TransactionContext(bizContext(param), func(tx db.Database) (e error) {
+				results, e = runBatch(tx, req.Operations)
+				return
+			}); err != nil {
+				return
+			}
+			data = results
+			return
+		}
+
 		bizModule["update"] = func(param *fpm.BizParam) (data interface{}, err error) {
 			req := queryReq{}
 			if err = param.Convert(&req); err != nil {
 				return
 			}
 
-			q := parseQuery(&req)
+			q, err := parseQuery(&req)
+			if err != nil {
+				return nil, err
+			}
 			//here, it's unsafe, the condition could be interface{}
 			// q.SetCondition(req.Condition.(string))
 			var rows int64
@@ -231,11 +503,26 @@ func init() {
 			if err = utils.Interface2Struct(req.Data, &cm); err != nil {
 				return
 			}
-			err = dbclient.Updates(q.BaseData, cm, &rows)
+			if req.Version != nil {
+				var next interface{}
+				if err = dbclient.(plugins.VersionUpdater).UpdatesVersionContext(bizContext(param), q.BaseData, toColumns(cm), req.Version, &rows, &next); err != nil {
+					return
+				}
+				data = map[string]interface{}{
+					"rows":    rows,
+					"version": next,
+				}
+				return
+			}
+			err = dbclient.UpdatesContext(bizContext(param), q.BaseData, toColumns(cm), &rows)
 			data = rows
 			return
 		}
 
+		for name, handler := range bizModule {
+			bizModule[name] = withBizError(handler)
+			app.AddFilter("common."+name, "before", contextFilter, 0)
+		}
 		app.AddBizModule("common", &bizModule)
 	})
 }
@@ -1,9 +1,15 @@
 package pg
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/errno"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
 )
 
 func TestParseQuery(t *testing.T) {
@@ -17,9 +23,11 @@ func TestParseQuery(t *testing.T) {
 		ID:        0,
 		Sort:      "id-",
 	}
-	q := parseQuery(req)
+	q, err := parseQuery(req)
+	assert.Nil(t, err, "should nil err")
 	assert.Equal(t, q.Table, "fake", "shoule be fake")
-	assert.Equal(t, q.Condition, "name = 'C'", "")
+	assert.Equal(t, q.Condition, "id = ?", "the id should override the condition")
+	assert.Equal(t, q.Arguments, []interface{}{int64(0)}, "")
 	assert.Equal(t, q.Pager.Skip, 0, "")
 	assert.Equal(t, q.Fields[0], "name", "")
 	assert.Equal(t, q.Fields[1], "val", "")
@@ -27,3 +35,247 @@ func TestParseQuery(t *testing.T) {
 	assert.Equal(t, q.Sorter[0].Sortby, "id", "")
 	assert.Equal(t, q.Sorter[0].Asc, "desc", "")
 }
+
+func TestBizContext(t *testing.T) {
+	param := &fpm.BizParam{
+		"table": "fake",
+	}
+	assert.Equal(t, context.Background(), bizContext(param), "should be background")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	SetContext(param, ctx)
+	assert.Equal(t, ctx, bizContext(param), "should be the ctx")
+
+	req := queryReq{}
+	assert.Nil(t, param.Convert(&req), "should convert with the ctx")
+	assert.Equal(t, "fake", req.Table, "")
+}
+
+func TestParseQueryLegacyKeys(t *testing.T) {
+	// the unknown naming falls back to none
+	option.Naming = "snake"
+	naming = plugins.NewNamingStrategy(option.Naming)
+	defer func() {
+		option.Naming = plugins.NamingNone
+		naming = plugins.NewNamingStrategy(plugins.NamingNone)
+	}()
+
+	q, err := parseQuery(&queryReq{
+		Table:  "fake",
+		Fields: "name,createAt",
+	})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, []string{"name", "created_at", "(floor(extract(epoch from created_at) *1000)::bigint) as createAt"}, q.Fields, "should expand the createAt")
+}
+
+func TestParseQueryCamel(t *testing.T) {
+	option.Naming = plugins.NamingCamel
+	naming = plugins.NewNamingStrategy(plugins.NamingCamel)
+	defer func() {
+		option.Naming = plugins.NamingNone
+		naming = plugins.NewNamingStrategy(plugins.NamingNone)
+	}()
+
+	req := &queryReq{
+		Table: "fake",
+		Condition: map[string]interface{}{
+			"userName": "C",
+		},
+		Fields: "userName,createdAt",
+		Sort:   "createdAt-",
+	}
+	q, err := parseQuery(req)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "user_name = ?", q.Condition, "")
+	assert.Equal(t, []string{"user_name", "created_at"}, q.Fields, "")
+	assert.Equal(t, "created_at", q.Sorter[0].Sortby, "")
+	assert.Equal(t, map[string]interface{}{"userName": "C"}, toKeys(map[string]interface{}{"user_name": "C"}), "")
+}
+
+func TestParseQueryInvalidCondition(t *testing.T) {
+	_, err := parseQuery(&queryReq{
+		Table:     "fake",
+		Condition: map[string]interface{}{"1=1 or name": "C"},
+	})
+	assert.NotNil(t, err, "should err with the invalid column")
+
+	_, err = parseQuery(&queryReq{
+		Table:     "fake",
+		Condition: []interface{}{"name"},
+	})
+	assert.NotNil(t, err, "should err with the unsupported condition")
+}
+
+func TestParseSort(t *testing.T) {
+	sorters, err := parseSort("status+, createdAt- nulls last,name")
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, 3, len(sorters), "")
+	assert.Equal(t, "status", sorters[0].Sortby, "")
+	assert.Equal(t, "asc", sorters[0].Asc, "")
+	assert.Equal(t, "createdAt", sorters[1].Sortby, "")
+	assert.Equal(t, "desc nulls last", sorters[1].Asc, "")
+	assert.Equal(t, "name", sorters[2].Sortby, "")
+
+	sorters, err = parseSort([]interface{}{
+		"id-",
+		map[string]interface{}{"field": "value", "order": "asc", "nulls": "first"},
+	})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "desc", sorters[0].Asc, "")
+	assert.Equal(t, "asc nulls first", sorters[1].Asc, "")
+
+	_, err = parseSort("id;drop table fake-")
+	assert.NotNil(t, err, "should err")
+}
+
+func TestParseUpsert(t *testing.T) {
+	param := &fpm.BizParam{
+		"table":    "fake",
+		"row":      []interface{}{map[string]interface{}{"code": "a", "value": 1}, map[string]interface{}{"code": "b", "value": 2}},
+		"conflict": "code",
+		"updates":  []interface{}{"value"},
+	}
+	req, rows, option, err := parseUpsertFromBizParam(param)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "fake", req.Table, "")
+	assert.Equal(t, 2, len(rows), "")
+	assert.Equal(t, []string{"code"}, option.Conflict, "")
+	assert.Equal(t, []string{"value"}, option.Updates, "")
+
+	(*param)["row"] = "a"
+	_, _, _, err = parseUpsertFromBizParam(param)
+	assert.NotNil(t, err, "should err on the invalid row")
+}
+
+func TestParseBatchUpdate(t *testing.T) {
+	param := &fpm.BizParam{
+		"table": "fake",
+		"rows": []interface{}{
+			map[string]interface{}{"id": 1, "changes": map[string]interface{}{"value": 101}},
+			map[string]interface{}{"id": 2, "changes": map[string]interface{}{"value": 102}},
+		},
+	}
+	q, list, err := parseBatchUpdateFromBizParam(param)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "fake", q.Table, "")
+	assert.Equal(t, 2, len(list), "")
+	assert.Equal(t, float64(102), list[1].Changes["value"], "")
+
+	delete(*param, "rows")
+	_, _, err = parseBatchUpdateFromBizParam(param)
+	assert.NotNil(t, err, "should err without rows")
+}
+
+//batchStub record the operations of the batch, the created id is increased from 1
+type batchStub struct {
+	db.Database
+	updates  []db.CommonMap
+	versions []interface{}
+}
+
+func (s *batchStub) Create(q *db.BaseData, entity interface{}) error {
+	row := entity.(*map[string]interface{})
+	(*row)["id"] = int64(1<<60 + len(s.updates) + 1)
+	return nil
+}
+
+func (s *batchStub) UpdatesVersion(q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) error {
+	s.updates = append(s.updates, updates)
+	s.versions = append(s.versions, version)
+	*rows = 1
+	*next = version.(int64) + 1
+	return nil
+}
+
+func (s *batchStub) UpdatesVersionContext(ctx context.Context, q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) error {
+	return s.UpdatesVersion(q, updates, version, rows, next)
+}
+
+func (s *batchStub) Updates(q *db.BaseData, updates db.CommonMap, rows *int64) error {
+	s.updates = append(s.updates, updates)
+	*rows = 1
+	return nil
+}
+
+func TestRunBatch(t *testing.T) {
+	stub := &batchStub{}
+	results, err := runBatch(stub, []map[string]interface{}{
+		{"op": "create", "table": "orders", "row": map[string]interface{}{"amount": 1}, "as": "order"},
+		{"op": "update", "table": "stock", "id": 3, "row": map[string]interface{}{"order_id": "${order.id}", "note": "${0.amount}"}},
+	})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, 2, len(results), "")
+	assert.Equal(t, map[string]interface{}{"rows": int64(1)}, results[1], "")
+	assert.Equal(t, int64(1<<60+1), stub.updates[0]["order_id"], "the referenced bigint should be exact")
+	assert.Equal(t, int64(1), stub.updates[0]["note"], "")
+
+	results, err = runBatch(stub, []map[string]interface{}{
+		{"op": "update", "table": "orders", "id": 3, "version": 2, "row": map[string]interface{}{"amount": 2}},
+	})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, map[string]interface{}{"rows": int64(1), "version": int64(3)}, results[0], "should update by the version")
+	assert.Equal(t, []interface{}{int64(2)}, stub.versions, "")
+
+	_, err = runBatch(stub, []map[string]interface{}{
+		{"op": "update", "table": "stock", "id": 3, "row": map[string]interface{}{"order_id": "${order.id}"}},
+	})
+	assert.NotNil(t, err, "should err on the unknown reference")
+
+	_, err = runBatch(stub, []map[string]interface{}{{"op": "drop", "table": "stock"}})
+	assert.NotNil(t, err, "should err on the unknown op")
+}
+
+func TestBizError(t *testing.T) {
+	err := bizError(&plugins.Error{Code: plugins.CodeNotFound, Err: errors.New("record not found")})
+	e, ok := err.(*errno.BizError)
+	assert.True(t, ok, "should be the errno")
+	assert.Equal(t, -404, e.Code, "")
+	assert.Equal(t, "NOT_FOUND: record not found", e.Message, "")
+
+	other := errors.New("foo")
+	assert.Equal(t, other, bizError(other), "the unknown errors should be returned as is")
+
+	handler := withBizError(func(*fpm.BizParam) (interface{}, error) {
+		return 1, nil
+	})
+	data, err := handler(&fpm.BizParam{})
+	assert.Nil(t, err, "")
+	assert.Equal(t, 1, data, "")
+}
+
+func TestEmptyIfNotFound(t *testing.T) {
+	notFound := &plugins.Error{Code: plugins.CodeNotFound, Err: errors.New("record not found")}
+	assert.Nil(t, emptyIfNotFound(notFound), "should respond {} by default")
+	other := errors.New("foo")
+	assert.Equal(t, other, emptyIfNotFound(other), "")
+
+	option.NotFoundError = true
+	defer func() { option.NotFoundError = false }()
+	assert.Equal(t, notFound, emptyIfNotFound(notFound), "should respond the not found error")
+}
+
+func TestColumnValues(t *testing.T) {
+	// the scanned key of the t.name is name
+	values := columnValues([]map[string]interface{}{{"name": "a"}, {"name": nil}})
+	assert.Equal(t, []interface{}{"a", nil}, values, "")
+}
+
+func TestHasFilter(t *testing.T) {
+	assert.False(t, hasFilter(&queryReq{Table: "fake"}), "destroy should be rejected without the condition or id")
+	assert.False(t, hasFilter(&queryReq{Table: "fake", Condition: " "}), "")
+	assert.False(t, hasFilter(&queryReq{Table: "fake", Condition: map[string]interface{}{}}), "")
+	assert.True(t, hasFilter(&queryReq{Table: "fake", Condition: "name = 'c'"}), "")
+	assert.True(t, hasFilter(&queryReq{Table: "fake", Condition: map[string]interface{}{"name": "c"}}), "")
+	assert.True(t, hasFilter(&queryReq{Table: "fake", ID: 0.0}), "")
+}
+
+func TestParseFilteredQuery(t *testing.T) {
+	_, err := parseFilteredQuery(&fpm.BizParam{"table": "fake"}, "RESTORE")
+	assert.NotNil(t, err, "restore should be rejected without the condition or id")
+	assert.Contains(t, err.Error(), "INVALID_RESTORE", "")
+
+	q, err := parseFilteredQuery(&fpm.BizParam{"table": "fake", "id": 1}, "RESTORE")
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "id = ?", q.Condition, "")
+}
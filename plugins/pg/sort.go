@@ -0,0 +1,113 @@
+package pg
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+var reNulls = regexp.MustCompile(`(?i)\s+nulls\s+(first|last)$`)
+
+//sortReq the sort item in the object form
+type sortReq struct {
+	Field string `json:"field"`
+	Order string `json:"order"`
+	Nulls string `json:"nulls"`
+}
+
+//parseSort parse the sort into the sorters, it could be:
+// "status+,createdAt- nulls last"
+// ["status+", "createdAt- nulls last"]
+// [{"field": "createdAt", "order": "desc", "nulls": "last"}]
+func parseSort(sort interface{}) (sorters []db.Sorter, err error) {
+	sorters = make([]db.Sorter, 0)
+	switch sort.(type) {
+	case nil:
+		return
+	case string:
+		for _, item := range strings.Split(sort.(string), ",") {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			var sorter db.Sorter
+			if sorter, err = parseSortItem(item); err != nil {
+				return
+			}
+			sorters = append(sorters, sorter)
+		}
+	case []interface{}:
+		for _, item := range sort.([]interface{}) {
+			var sorter db.Sorter
+			switch item.(type) {
+			case string:
+				sorter, err = parseSortItem(item.(string))
+			case map[string]interface{}:
+				req := sortReq{}
+				m := item.(map[string]interface{})
+				req.Field, _ = m["field"].(string)
+				req.Order, _ = m["order"].(string)
+				req.Nulls, _ = m["nulls"].(string)
+				sorter, err = newSorter(req)
+			default:
+				err = plugins.Invalidf("INVALID_SORT: %v", item)
+			}
+			if err != nil {
+				return
+			}
+			sorters = append(sorters, sorter)
+		}
+	default:
+		err = plugins.Invalidf("INVALID_SORT: %v", sort)
+	}
+	return
+}
+
+//parseSortItem parse the name+, name- or name-  nulls last
+func parseSortItem(item string) (db.Sorter, error) {
+	req := sortReq{}
+	item = strings.TrimSpace(item)
+	if m := reNulls.FindStringSubmatch(item); m != nil {
+		req.Nulls = m[1]
+		item = strings.TrimSpace(item[:len(item)-len(m[0])])
+	}
+	req.Field = item
+	if l := len(item); l > 0 {
+		switch item[l-1:] {
+		case "-":
+			req.Order = "desc"
+			req.Field = item[:l-1]
+		case "+":
+			req.Field = item[:l-1]
+		}
+	}
+	return newSorter(req)
+}
+
+//newSorter validate the sort item and create the sorter
+func newSorter(req sortReq) (sorter db.Sorter, err error) {
+	column := naming.Column(strings.TrimSpace(req.Field))
+	if !plugins.IsColumn(column) {
+		return sorter, plugins.Invalidf("INVALID_SORT: %s", req.Field)
+	}
+	asc := "asc"
+	switch strings.ToLower(req.Order) {
+	case "", "asc", "+":
+	case "desc", "-":
+		asc = "desc"
+	default:
+		return sorter, plugins.Invalidf("INVALID_SORT: %s %s", req.Field, req.Order)
+	}
+	switch strings.ToLower(req.Nulls) {
+	case "":
+	case "first", "last":
+		asc += " nulls " + strings.ToLower(req.Nulls)
+	default:
+		return sorter, plugins.Invalidf("INVALID_SORT: nulls %s", req.Nulls)
+	}
+	return db.Sorter{
+		Sortby: column,
+		Asc:    asc,
+	}, nil
+}
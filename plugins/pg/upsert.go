@@ -0,0 +1,62 @@
+package pg
+
+import (
+	"strings"
+
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
+	"github.com/team4yf/yf-fpm-server-go/fpm"
+)
+
+type upsertReq struct {
+	Table    string      `json:"table,omitempty"`
+	Data     interface{} `json:"row,omitempty"`
+	Conflict interface{} `json:"conflict,omitempty"`
+	Updates  interface{} `json:"updates,omitempty"`
+}
+
+//parseUpsertFromBizParam parse the rows and the option of the upsert, the row could be a object or a array
+func parseUpsertFromBizParam(param *fpm.BizParam) (req *upsertReq, rows []map[string]interface{}, option plugins.UpsertOption, err error) {
+	req = &upsertReq{}
+	if err = param.Convert(req); err != nil {
+		return
+	}
+	switch req.Data.(type) {
+	case map[string]interface{}:
+		rows = append(rows, toColumns(req.Data.(map[string]interface{})))
+	case []interface{}:
+		for _, one := range req.Data.([]interface{}) {
+			row, ok := one.(map[string]interface{})
+			if !ok {
+				err = plugins.Invalidf("INVALID_UPSERT: the row should be a object")
+				return
+			}
+			rows = append(rows, toColumns(row))
+		}
+	default:
+		err = plugins.Invalidf("INVALID_UPSERT: row required")
+		return
+	}
+	option.Conflict = parseColumns(req.Conflict)
+	option.Updates = parseColumns(req.Updates)
+	return
+}
+
+//parseColumns parse the comma-separated list or the array of the keys into the columns
+func parseColumns(v interface{}) []string {
+	columns := make([]string, 0)
+	switch v.(type) {
+	case string:
+		for _, k := range strings.Split(v.(string), ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				columns = append(columns, naming.Column(k))
+			}
+		}
+	case []interface{}:
+		for _, k := range v.([]interface{}) {
+			if s, ok := k.(string); ok {
+				columns = append(columns, naming.Column(s))
+			}
+		}
+	}
+	return columns
+}
@@ -0,0 +1,232 @@
+package plugins
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	queryLocker sync.RWMutex
+	queries     = make(map[string]*NamedQuery)
+)
+
+//QueryParam the declared parameter of the named query: -- @param name type [required]
+type QueryParam struct {
+	Name string
+	// string, int, float, bool, time or any
+	Type     string
+	Required bool
+}
+
+//NamedQuery the vetted sql with the :name parameters
+type NamedQuery struct {
+	Name   string
+	SQL    string
+	Params []QueryParam
+}
+
+//QueryRunner run the named queries
+type QueryRunner interface {
+	//RunQuery run the named query with the params, the undeclared params are rejected
+	RunQuery(name string, params map[string]interface{}, result *[]map[string]interface{}) error
+
+	RunQueryContext(ctx context.Context, name string, params map[string]interface{}, result *[]map[string]interface{}) error
+}
+
+//ParseQuery parse the params declared by the comments of the sql
+//Ex:
+// -- @param name string required
+// -- @param min int
+// select * from fake where name = :name and value > :min
+func ParseQuery(name, sql string) (query *NamedQuery, err error) {
+	query = &NamedQuery{
+		Name:   name,
+		SQL:    sql,
+		Params: make([]QueryParam, 0),
+	}
+	for _, line := range strings.Split(sql, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "--") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "--"))
+		if len(fields) < 2 || fields[0] != "@param" {
+			continue
+		}
+		param := QueryParam{
+			Name: fields[1],
+			Type: "any",
+		}
+		for _, f := range fields[2:] {
+			switch f = strings.ToLower(f); f {
+			case "required":
+				param.Required = true
+			case "string", "int", "float", "bool", "time", "any":
+				param.Type = f
+			default:
+				return nil, Invalidf("INVALID_QUERY: %s of the param %s in %s", f, param.Name, name)
+			}
+		}
+		query.Params = append(query.Params, param)
+	}
+	return
+}
+
+//RegisterQuery register the named query
+func RegisterQuery(name, sql string) (err error) {
+	query, err := ParseQuery(name, sql)
+	if err != nil {
+		return
+	}
+	queryLocker.Lock()
+	defer queryLocker.Unlock()
+	queries[name] = query
+	return
+}
+
+//GetQuery get the named query
+func GetQuery(name string) (query *NamedQuery, ok bool) {
+	queryLocker.RLock()
+	defer queryLocker.RUnlock()
+	query, ok = queries[name]
+	return
+}
+
+//LoadQueries register the .sql files under the dir, the name is the file name without the .sql,
+//it's ok if the dir not exists
+func LoadQueries(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || filepath.Ext(f.Name()) != ".sql" {
+			continue
+		}
+		raw, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return err
+		}
+		if err = RegisterQuery(strings.TrimSuffix(f.Name(), ".sql"), string(raw)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//bind validate the params by the declared types, the missing params are nil
+func (q *NamedQuery) bind(params map[string]interface{}) (values map[string]interface{}, err error) {
+	values = make(map[string]interface{}, len(q.Params))
+	for name := range params {
+		declared := false
+		for _, p := range q.Params {
+			if p.Name == name {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			return nil, Invalidf("INVALID_PARAM: %s not declared", name)
+		}
+	}
+	for _, p := range q.Params {
+		v, ok := params[p.Name]
+		if !ok || v == nil {
+			if p.Required {
+				return nil, Invalidf("INVALID_PARAM: %s required", p.Name)
+			}
+			values[p.Name] = nil
+			continue
+		}
+		if values[p.Name], err = convertParam(p, v); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+//convertParam convert the json value to the declared type
+func convertParam(p QueryParam, v interface{}) (interface{}, error) {
+	invalid := Invalidf("INVALID_PARAM: %s should be %s", p.Name, p.Type)
+	switch p.Type {
+	case "string":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return nil, invalid
+	case "int":
+		switch n := normalizeValue(v).(type) {
+		case int64:
+			return n, nil
+		case int:
+			return int64(n), nil
+		}
+		return nil, invalid
+	case "float":
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case int64:
+			return float64(n), nil
+		}
+		return nil, invalid
+	case "bool":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, invalid
+	case "time":
+		switch t := v.(type) {
+		case time.Time:
+			return t, nil
+		case string:
+			parsed, err := time.Parse(time.RFC3339, t)
+			if err != nil {
+				return nil, invalid
+			}
+			return parsed, nil
+		case float64:
+			// the epoch millis
+			return time.Unix(0, int64(t)*int64(time.Millisecond)), nil
+		}
+		return nil, invalid
+	}
+	return normalizeValue(v), nil
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.QueryRunner).RunQuery("daily_report", map[string]interface{}{"day": "2020-10-01T00:00:00Z"}, &list)
+func (p *ormImpl) RunQuery(name string, params map[string]interface{}, result *[]map[string]interface{}) error {
+	query, ok := GetQuery(name)
+	if !ok {
+		return Invalidf("INVALID_QUERY: %s not found", name)
+	}
+	values, err := query.bind(params)
+	if err != nil {
+		return err
+	}
+	if len(query.Params) == 0 {
+		return p.RawArgs(query.SQL, result)
+	}
+	return p.RawArgs(query.SQL, result, values)
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.QueryRunner).RunQueryContext(ctx, "daily_report", map[string]interface{}{"day": "2020-10-01T00:00:00Z"}, &list)
+func (p *ormImpl) RunQueryContext(ctx context.Context, name string, params map[string]interface{}, result *[]map[string]interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.RunQuery(name, params, result)
+}
@@ -0,0 +1,46 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNamedQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "queries")
+	assert.Nil(t, err, "should nil err")
+	defer os.RemoveAll(dir)
+	sql := "-- @param name string required\n-- @param min int\nselect * from fake where name = :name and value > :min"
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "fake_report.sql"), []byte(sql), 0644), "")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "readme.md"), []byte("-"), 0644), "")
+
+	assert.Nil(t, LoadQueries(dir), "should nil err")
+	assert.Nil(t, LoadQueries(filepath.Join(dir, "none")), "should ignore the missing dir")
+	_, ok := GetQuery("readme")
+	assert.False(t, ok, "should skip the non-sql files")
+
+	query, ok := GetQuery("fake_report")
+	assert.True(t, ok, "should be loaded")
+	assert.Equal(t, []QueryParam{{Name: "name", Type: "string", Required: true}, {Name: "min", Type: "int"}}, query.Params, "")
+
+	values, err := query.bind(map[string]interface{}{"name": "c", "min": float64(1)})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, map[string]interface{}{"name": "c", "min": int64(1)}, values, "")
+
+	values, err = query.bind(map[string]interface{}{"name": "c"})
+	assert.Nil(t, err, "should nil err")
+	assert.Nil(t, values["min"], "the missing param is nil")
+
+	_, err = query.bind(map[string]interface{}{"min": float64(1)})
+	assert.NotNil(t, err, "should err on the missing required param")
+	_, err = query.bind(map[string]interface{}{"name": "c", "min": 1.5})
+	assert.NotNil(t, err, "should err on the type")
+	_, err = query.bind(map[string]interface{}{"name": "c", "max": 1})
+	assert.NotNil(t, err, "should err on the undeclared param")
+
+	_, err = ParseQuery("bad", "-- @param a blob\nselect 1")
+	assert.NotNil(t, err, "should err on the unknown type")
+}
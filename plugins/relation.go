@@ -0,0 +1,239 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/gorm"
+)
+
+const (
+	//RelationHasMany the related rows are loaded as a slice
+	RelationHasMany = "hasMany"
+	//RelationHasOne the related row is loaded as a map, or nil
+	RelationHasOne = "hasOne"
+)
+
+var (
+	relationLocker sync.RWMutex
+	relations      = make(map[string]map[string]Relation)
+)
+
+//Relation the related table, the rows of the table with Table.ForeignKey = LocalKey are loaded
+type Relation struct {
+	Table      string `json:"table"`
+	ForeignKey string `json:"foreignKey"`
+	LocalKey   string `json:"localKey"`
+	Type       string `json:"type"`
+}
+
+//JoinOn the column pair of the join condition: Left = Right
+type JoinOn struct {
+	Left  string
+	Right string
+}
+
+//Join the joined table, the soft-deleted rows of the joined table are excluded
+type Join struct {
+	// inner, left
+	Type  string
+	Table string
+	Alias string
+	On    []JoinOn
+}
+
+//JoinQuery the find query with the joins, and the relations to load into the result rows.
+//The columns should be qualified by the table if ambiguous, the fields are table.* by default.
+type JoinQuery struct {
+	*db.QueryData
+	Joins    []Join
+	Includes []string
+}
+
+//NewJoinQuery create a join query
+func NewJoinQuery() *JoinQuery {
+	return &JoinQuery{
+		QueryData: db.NewQuery(),
+		Joins:     make([]Join, 0),
+		Includes:  make([]string, 0),
+	}
+}
+
+//Joiner run the join queries
+type Joiner interface {
+	FindJoin(q *JoinQuery, result *[]map[string]interface{}) error
+
+	FindJoinContext(ctx context.Context, q *JoinQuery, result *[]map[string]interface{}) error
+}
+
+//RegisterRelation declare the relation named name of the table
+func RegisterRelation(table, name string, relation Relation) {
+	relationLocker.Lock()
+	defer relationLocker.Unlock()
+	if relation.Type == "" {
+		relation.Type = RelationHasMany
+	}
+	if relation.LocalKey == "" {
+		relation.LocalKey = "id"
+	}
+	if _, ok := relations[table]; !ok {
+		relations[table] = make(map[string]Relation)
+	}
+	relations[table][name] = relation
+}
+
+//GetRelation get the relation named name of the table
+func GetRelation(table, name string) (relation Relation, ok bool) {
+	relationLocker.RLock()
+	defer relationLocker.RUnlock()
+	relation, ok = relations[table][name]
+	return
+}
+
+//build the sql of the join, the soft-deleted rows are excluded if the table has the deleted_at
+func (j Join) build(softDelete bool) (string, error) {
+	var typ string
+	switch strings.ToLower(j.Type) {
+	case "", "inner":
+		typ = "INNER JOIN"
+	case "left":
+		typ = "LEFT JOIN"
+	default:
+		return "", Invalidf("INVALID_JOIN: %s", j.Type)
+	}
+	if !IsColumn(j.Table) || (j.Alias != "" && !IsColumn(j.Alias)) {
+		return "", Invalidf("INVALID_JOIN: %s %s", j.Table, j.Alias)
+	}
+	if len(j.On) == 0 {
+		return "", Invalidf("INVALID_JOIN: %s without on", j.Table)
+	}
+	name := j.Table
+	if j.Alias != "" {
+		name = j.Table + " " + j.Alias
+	}
+	ons := make([]string, 0, len(j.On)+1)
+	for _, on := range j.On {
+		if !IsColumn(on.Left) || !IsColumn(on.Right) {
+			return "", Invalidf("INVALID_JOIN: %s = %s", on.Left, on.Right)
+		}
+		ons = append(ons, on.Left+" = "+on.Right)
+	}
+	ref := j.Table
+	if j.Alias != "" {
+		ref = j.Alias
+	}
+	if softDelete {
+		ons = append(ons, ref+".deleted_at is null")
+	}
+	return fmt.Sprintf("%s %s ON %s", typ, name, strings.Join(ons, " and ")), nil
+}
+
+//OK
+//Ex:
+// q := plugins.NewJoinQuery()
+// q.SetTable("users")
+// q.Joins = []plugins.Join{{Type: "left", Table: "profiles", On: []plugins.JoinOn{{Left: "profiles.user_id", Right: "users.id"}}}}
+// q.Includes = []string{"orders"}
+// err = dbclient.(plugins.Joiner).FindJoin(q, &list)
+func (p *ormImpl) FindJoin(q *JoinQuery, result *[]map[string]interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("find", q.Table, begin, err) }(time.Now())
+	query, err := p.joinQuery(q)
+	if err != nil {
+		return
+	}
+	list := make([]map[string]interface{}, 0)
+	if err = p.eachQuery(query, func(m map[string]interface{}) error {
+		list = append(list, m)
+		return nil
+	}); err != nil {
+		return
+	}
+	if err = p.preload(q.Table, q.Includes, list); err != nil {
+		return
+	}
+	*result = append(*result, list...)
+	return
+}
+
+func (p *ormImpl) FindJoinContext(ctx context.Context, q *JoinQuery, result *[]map[string]interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.FindJoin(q, result)
+}
+
+func (p *ormImpl) joinQuery(q *JoinQuery) (*gorm.DB, error) {
+	query := p.db.Table(q.Table)
+	for _, j := range q.Joins {
+		sql, err := j.build(!p.tableOption(j.Table).NoSoftDelete)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Joins(sql)
+	}
+	query = query.Where(p.scoped(q.Table, q.Condition, q.Table+".deleted_at"), q.Arguments...)
+	if len(q.Fields) > 0 {
+		query = query.Select(strings.Join(q.Fields, ","))
+	} else {
+		query = query.Select(q.Table + ".*")
+	}
+	for _, sort := range q.Sorter {
+		query = query.Order(sort.Sortby + " " + sort.Asc)
+	}
+	return query.Offset(q.Pager.Skip).Limit(q.Pager.Limit), nil
+}
+
+//preload load the relations of the table into the rows, the soft-deleted related rows are excluded
+func (p *ormImpl) preload(table string, includes []string, list []map[string]interface{}) (err error) {
+	alive := p.session(p.db)
+	alive.deleted = deletedExclude
+	for _, name := range includes {
+		relation, ok := GetRelation(table, name)
+		if !ok {
+			return Invalidf("INVALID_INCLUDE: %s", name)
+		}
+		keys := make([]interface{}, 0)
+		exists := make(map[string]bool)
+		for _, row := range list {
+			v, ok := row[relation.LocalKey]
+			if !ok {
+				return Invalidf("INVALID_INCLUDE: column %s not selected", relation.LocalKey)
+			}
+			if k := fmt.Sprint(v); v != nil && !exists[k] {
+				exists[k] = true
+				keys = append(keys, v)
+			}
+		}
+		related := make(map[string][]map[string]interface{})
+		if len(keys) > 0 {
+			sub := db.NewQuery()
+			sub.SetTable(relation.Table).SetCondition(relation.ForeignKey+" in ?", keys)
+			if err = alive.each(sub, func(m map[string]interface{}) error {
+				k := fmt.Sprint(m[relation.ForeignKey])
+				related[k] = append(related[k], m)
+				return nil
+			}); err != nil {
+				return
+			}
+		}
+		for _, row := range list {
+			rows := related[fmt.Sprint(row[relation.LocalKey])]
+			if relation.Type == RelationHasOne {
+				if len(rows) > 0 {
+					row[name] = rows[0]
+				} else {
+					row[name] = nil
+				}
+				continue
+			}
+			if rows == nil {
+				rows = make([]map[string]interface{}, 0)
+			}
+			row[name] = rows
+		}
+	}
+	return
+}
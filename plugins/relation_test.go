@@ -0,0 +1,43 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinQuery(t *testing.T) {
+	q := NewJoinQuery()
+	q.SetTable("users").SetCondition("users.name = ?", "c")
+	q.AddFields("users.id", "orders.amount")
+	q.Joins = []Join{{
+		Type:  "left",
+		Table: "orders",
+		On:    []JoinOn{{Left: "orders.user_id", Right: "users.id"}},
+	}}
+
+	query, err := dryRunImpl(t).joinQuery(q)
+	assert.Nil(t, err, "should nil err")
+	list := make([]map[string]interface{}, 0)
+	stmt := query.Find(&list).Statement
+	assert.Equal(t, `SELECT users.id,orders.amount FROM "users" LEFT JOIN orders ON orders.user_id = users.id and orders.deleted_at is null WHERE (users.name = $1) and users.deleted_at is null`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	q.Joins[0].On[0].Right = "users.id or 1=1"
+	_, err = dryRunImpl(t).joinQuery(q)
+	assert.NotNil(t, err, "should err")
+}
+
+func TestRelation(t *testing.T) {
+	RegisterRelation("users", "orders", Relation{
+		Table:      "orders",
+		ForeignKey: "user_id",
+	})
+	relation, ok := GetRelation("users", "orders")
+	assert.Equal(t, true, ok, "should exist")
+	assert.Equal(t, "id", relation.LocalKey, "")
+	assert.Equal(t, RelationHasMany, relation.Type, "")
+
+	err := dryRunImpl(t).preload("users", []string{"profile"}, nil)
+	assert.NotNil(t, err, "should err on the unknown relation")
+}
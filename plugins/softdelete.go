@@ -0,0 +1,124 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+const (
+	// the soft-deleted rows are excluded, by default
+	deletedExclude = iota
+	// the soft-deleted rows are included
+	deletedWith
+	// only the soft-deleted rows are matched
+	deletedOnly
+)
+
+//SoftDeleter query, restore or purge the soft-deleted rows
+type SoftDeleter interface {
+	//WithDeleted the queries of the returned database match the soft-deleted rows too
+	WithDeleted() db.Database
+
+	//OnlyDeleted the queries of the returned database match the soft-deleted rows only
+	OnlyDeleted() db.Database
+
+	//Restore clear the deleted_at of the soft-deleted rows
+	Restore(q *db.BaseData, rows *int64) error
+
+	RestoreContext(ctx context.Context, q *db.BaseData, rows *int64) error
+
+	//Destroy delete the rows from the table, it can't be undone
+	Destroy(q *db.BaseData, rows *int64) error
+
+	DestroyContext(ctx context.Context, q *db.BaseData, rows *int64) error
+}
+
+//WithDeleted run the queries without the deleted_at filter
+func (p *ormImpl) WithDeleted() db.Database {
+	tx := p.session(p.db)
+	tx.deleted = deletedWith
+	return tx
+}
+
+//OnlyDeleted run the queries on the soft-deleted rows
+func (p *ormImpl) OnlyDeleted() db.Database {
+	tx := p.session(p.db)
+	tx.deleted = deletedOnly
+	return tx
+}
+
+//scoped append the deleted_at filter of the scope to the condition,
+//the column is qualified like t.deleted_at for the join queries.
+//The tables without the deleted_at have no soft-deleted rows.
+func (p *ormImpl) scoped(table, condition, column string) string {
+	if p.tableOption(table).NoSoftDelete {
+		if p.deleted == deletedOnly {
+			return fmt.Sprintf("(%s) and 1=0", condition)
+		}
+		return fmt.Sprintf("(%s)", condition)
+	}
+	switch p.deleted {
+	case deletedWith:
+		return fmt.Sprintf("(%s)", condition)
+	case deletedOnly:
+		return fmt.Sprintf("(%s) and %s is not null", condition, column)
+	}
+	return fmt.Sprintf("(%s) and %s is null", condition, column)
+}
+
+//OK
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake").SetCondition("id = ?", 1)
+// err = dbclient.(plugins.SoftDeleter).Restore(q.BaseData, &rows)
+func (p *ormImpl) Restore(q *db.BaseData, rows *int64) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("restore", q.Table, begin, err) }(time.Now())
+	option := p.tableOption(q.Table)
+	if option.NoSoftDelete {
+		return Invalidf("INVALID_RESTORE: %s has no deleted_at", q.Table)
+	}
+	args := q.Arguments
+	sets := "deleted_at=NULL"
+	if !option.NoTimestamps {
+		sets += ", updated_at=?"
+		args = append([]interface{}{time.Now()}, q.Arguments...)
+	}
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE deleted_at is not null and ( %s )", q.Table, sets, q.Condition)
+	d := p.db.Exec(sql, args...)
+	if err = d.Error; err != nil {
+		return
+	}
+	*rows = d.RowsAffected
+	return
+}
+
+func (p *ormImpl) RestoreContext(ctx context.Context, q *db.BaseData, rows *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Restore(q, rows)
+}
+
+//OK
+//The rows are deleted whether soft-deleted or not
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake").SetCondition("deleted_at < ?", expired)
+// err = dbclient.(plugins.SoftDeleter).Destroy(q.BaseData, &rows)
+func (p *ormImpl) Destroy(q *db.BaseData, rows *int64) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("destroy", q.Table, begin, err) }(time.Now())
+	d := p.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", q.Table, q.Condition), q.Arguments...)
+	if err = d.Error; err != nil {
+		return
+	}
+	*rows = d.RowsAffected
+	return
+}
+
+func (p *ormImpl) DestroyContext(ctx context.Context, q *db.BaseData, rows *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Destroy(q, rows)
+}
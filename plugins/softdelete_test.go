@@ -0,0 +1,30 @@
+package plugins
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestDeletedScope(t *testing.T) {
+	q := db.NewQuery()
+	q.SetTable("fake").SetCondition("value > ?", 1)
+
+	impl := dryRunImpl(t)
+	list := make([]map[string]interface{}, 0)
+	stmt := impl.findQuery(q).Find(&list).Statement
+	assert.Equal(t, `SELECT * FROM "fake" WHERE (value > $1) and deleted_at is null`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	stmt = impl.WithDeleted().(*ormImpl).findQuery(q).Find(&list).Statement
+	assert.Equal(t, `SELECT * FROM "fake" WHERE (value > $1)`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	only := impl.OnlyDeleted().(*ormImpl)
+	stmt = only.findQuery(q).Find(&list).Statement
+	assert.Equal(t, `SELECT * FROM "fake" WHERE (value > $1) and deleted_at is not null`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	// the scope is kept in the sessions
+	assert.Equal(t, deletedOnly, only.session(only.db).deleted, "")
+	assert.Equal(t, deletedExclude, impl.deleted, "")
+}
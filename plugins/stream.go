@@ -0,0 +1,131 @@
+package plugins
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/gorm"
+)
+
+//ErrStop return it from the handler to stop the iteration without error
+var ErrStop = errors.New("STOP_ITERATION")
+
+//Streamer scan the rows of the query one by one, for the large queries.
+//The next row is scanned after the handler returns, the iteration stops at the first error.
+type Streamer interface {
+	//Each scan the rows into map[string]interface{}
+	Each(q *db.QueryData, handler func(map[string]interface{}) error) error
+
+	EachContext(ctx context.Context, q *db.QueryData, handler func(map[string]interface{}) error) error
+
+	//EachRow scan the rows into the struct created by the iterator
+	EachRow(q *db.QueryData, iterator func() interface{}, handler func(interface{}) error) error
+
+	EachRowContext(ctx context.Context, q *db.QueryData, iterator func() interface{}, handler func(interface{}) error) error
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.Streamer).Each(q, func(row map[string]interface{}) error {
+// 	return writer.Write(row)
+// })
+func (p *ormImpl) Each(q *db.QueryData, handler func(map[string]interface{}) error) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("each", q.Table, begin, err) }(time.Now())
+	return p.each(q, handler)
+}
+
+func (p *ormImpl) EachContext(ctx context.Context, q *db.QueryData, handler func(map[string]interface{}) error) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Each(q, handler)
+}
+
+//OK
+//Ex:
+// err = dbclient.(plugins.Streamer).EachRow(q, func() interface{} {
+// 	return &Fake{}
+// }, func(one interface{}) error {
+// 	return writer.Write(one.(*Fake))
+// })
+func (p *ormImpl) EachRow(q *db.QueryData, iterator func() interface{}, handler func(interface{}) error) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("each", q.Table, begin, err) }(time.Now())
+	query := p.findQuery(q)
+	rows, err := query.Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		one := iterator()
+		if err = query.ScanRows(rows, one); err != nil {
+			return
+		}
+		if err = handler(one); err != nil {
+			if err == ErrStop {
+				err = nil
+			}
+			return
+		}
+	}
+	return rows.Err()
+}
+
+func (p *ormImpl) EachRowContext(ctx context.Context, q *db.QueryData, iterator func() interface{}, handler func(interface{}) error) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.EachRow(q, iterator, handler)
+}
+
+func (p *ormImpl) each(q *db.QueryData, handler func(map[string]interface{}) error) error {
+	return p.eachQuery(p.findQuery(q), handler)
+}
+
+//eachQuery scan the rows of the query into map[string]interface{} one by one
+func (p *ormImpl) eachQuery(query *gorm.DB, handler func(map[string]interface{}) error) (err error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	decoder, err := newColumnDecoder(rows, p.timeFormat)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var m map[string]interface{}
+		if m, err = scanMap(rows, cols, decoder); err != nil {
+			return
+		}
+		if err = handler(m); err != nil {
+			if err == ErrStop {
+				err = nil
+			}
+			return
+		}
+	}
+	return rows.Err()
+}
+
+//scanMap scan the current row into the map of the column, the values are decoded by the column types
+func scanMap(rows *sql.Rows, cols []string, decoder *columnDecoder) (m map[string]interface{}, err error) {
+	columns := make([]interface{}, len(cols))
+	columnPointers := make([]interface{}, len(cols))
+	for i := range columns {
+		columnPointers[i] = &columns[i]
+	}
+	if err = rows.Scan(columnPointers...); err != nil {
+		return
+	}
+	m = make(map[string]interface{})
+	for i, colName := range cols {
+		m[colName] = decoder.decode(i, columns[i])
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package plugins
+
+import (
+	"strings"
+	"sync"
+)
+
+var (
+	tableLocker sync.RWMutex
+	tables      = make(map[string]TableOption)
+	// the tables detected without the columns, like the missing tables
+	undetected = make(map[string]bool)
+)
+
+//TableOption the columns of the table, the tables have the deleted_at, created_at and updated_at columns by default
+type TableOption struct {
+	// NoSoftDelete the table has no deleted_at column, the rows are deleted by Remove
+	NoSoftDelete bool `json:"noSoftDelete"`
+	// NoTimestamps the table has no created_at and updated_at columns
+	NoTimestamps bool `json:"noTimestamps"`
+	// Version the version column of the optimistic locking, increased by the updates,
+	// updated_at to match the updated_at instead
+	Version string `json:"version"`
+}
+
+//RegisterTable declare the columns of the table, for the views, legacy tables or join tables
+func RegisterTable(table string, option TableOption) {
+	tableLocker.Lock()
+	defer tableLocker.Unlock()
+	tables[table] = option
+}
+
+//GetTable get the declared option of the table
+func GetTable(table string) (option TableOption, ok bool) {
+	tableLocker.RLock()
+	defer tableLocker.RUnlock()
+	option, ok = tables[table]
+	return
+}
+
+func isUndetected(table string) bool {
+	tableLocker.RLock()
+	defer tableLocker.RUnlock()
+	return undetected[table]
+}
+
+//tableOption get the option of the table, the columns are detected and registered at the first time if enabled,
+//the tables without the columns are detected once too
+func (p *ormImpl) tableOption(table string) TableOption {
+	if option, ok := GetTable(table); ok || !p.detect || isUndetected(table) {
+		return option
+	}
+	columns, err := p.columns(table)
+	if err != nil {
+		// keep the default, the query reports the error, detect again next time
+		return TableOption{}
+	}
+	if len(columns) == 0 {
+		tableLocker.Lock()
+		undetected[table] = true
+		tableLocker.Unlock()
+		return TableOption{}
+	}
+	option := TableOption{
+		NoSoftDelete: !columns["deleted_at"],
+		NoTimestamps: !columns["created_at"] || !columns["updated_at"],
+	}
+	RegisterTable(table, option)
+	return option
+}
+
+//columns get the columns of the table from the information_schema, the table could be schema.table
+func (p *ormImpl) columns(table string) (columns map[string]bool, err error) {
+	sql := "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ?"
+	args := []interface{}{table}
+	if i := strings.Index(table, "."); i > 0 {
+		sql = "SELECT column_name FROM information_schema.columns WHERE table_schema = ? AND table_name = ?"
+		args = []interface{}{table[:i], table[i+1:]}
+	}
+	rows, err := p.db.Raw(sql, args...).Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	columns = make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
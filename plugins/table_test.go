@@ -0,0 +1,93 @@
+package plugins
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+//emptyDriver the driver counts the queries, which return no rows
+type emptyDriver struct {
+	queries *int
+}
+
+func (d emptyDriver) Open(string) (driver.Conn, error) { return d, nil }
+
+func (d emptyDriver) Prepare(string) (driver.Stmt, error) { return d, nil }
+
+func (d emptyDriver) Close() error { return nil }
+
+func (d emptyDriver) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (d emptyDriver) NumInput() int { return -1 }
+
+func (d emptyDriver) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (d emptyDriver) Query([]driver.Value) (driver.Rows, error) {
+	*d.queries++
+	return emptyRows{}, nil
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string { return []string{"column_name"} }
+
+func (emptyRows) Close() error { return nil }
+
+func (emptyRows) Next([]driver.Value) error { return io.EOF }
+
+var emptyQueries int
+
+func init() {
+	sql.Register("empty", emptyDriver{queries: &emptyQueries})
+}
+
+func TestTableOption(t *testing.T) {
+	RegisterTable("v_report", TableOption{NoSoftDelete: true, NoTimestamps: true})
+
+	q := db.NewQuery()
+	q.SetTable("v_report").SetCondition("value > ?", 1)
+	impl := dryRunImpl(t)
+	list := make([]map[string]interface{}, 0)
+	stmt := impl.findQuery(q).Find(&list).Statement
+	assert.Equal(t, `SELECT * FROM "v_report" WHERE (value > $1)`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	stmt = impl.OnlyDeleted().(*ormImpl).findQuery(q).Find(&list).Statement
+	assert.Equal(t, `SELECT * FROM "v_report" WHERE (value > $1) and 1=0`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	jq := NewJoinQuery()
+	jq.SetTable("fake").SetCondition("1=1")
+	jq.Joins = []Join{{Type: "left", Table: "v_report", On: []JoinOn{{Left: "v_report.name", Right: "fake.name"}}}}
+	query, err := impl.joinQuery(jq)
+	assert.Nil(t, err, "should nil err")
+	stmt = query.Find(&list).Statement
+	assert.Equal(t, `SELECT fake.* FROM "fake" LEFT JOIN v_report ON v_report.name = fake.name WHERE (1=1) and fake.deleted_at is null`, strings.TrimSpace(stmt.SQL.String()), "")
+
+	err = impl.Restore(q.BaseData, new(int64))
+	assert.NotNil(t, err, "should err without deleted_at")
+}
+
+func TestDetectMissingTable(t *testing.T) {
+	conn, err := sql.Open("empty", "")
+	assert.Nil(t, err, "should nil err")
+	d, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{DisableAutomaticPing: true})
+	assert.Nil(t, err, "should nil err")
+	impl := &ormImpl{db: d, detect: true}
+
+	emptyQueries = 0
+	assert.Equal(t, TableOption{}, impl.tableOption("missing"), "should be the default")
+	assert.Equal(t, TableOption{}, impl.tableOption("missing"), "")
+	assert.Equal(t, 1, emptyQueries, "should detect once")
+	_, ok := GetTable("missing")
+	assert.False(t, ok, "should not be registered")
+}
@@ -0,0 +1,80 @@
+package plugins
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+var (
+	tracerLocker sync.RWMutex
+	tracer       Tracer
+)
+
+//Span the information of a finished sql, the sql is sanitized
+type Span struct {
+	Operation string
+	Table     string
+	SQL       string
+	Rows      int64
+	Begin     time.Time
+	End       time.Time
+	Err       error
+}
+
+//Tracer the tracing hook, called once per sql with the context of the query.
+//Adapt it to the opentelemetry like:
+// _, s := otelTracer.Start(ctx, "orm."+span.Operation, trace.WithTimestamp(span.Begin))
+// s.SetAttributes(...)
+// s.End(trace.WithTimestamp(span.End))
+type Tracer interface {
+	Trace(ctx context.Context, span *Span)
+}
+
+//SetTracer set the tracing hook for all the database instances, nil to disable it
+func SetTracer(t Tracer) {
+	tracerLocker.Lock()
+	defer tracerLocker.Unlock()
+	tracer = t
+}
+
+func getTracer() Tracer {
+	tracerLocker.RLock()
+	defer tracerLocker.RUnlock()
+	return tracer
+}
+
+//tracingLogger wrap the gorm logger, emit the span to the tracer before logging
+type tracingLogger struct {
+	logger.Interface
+}
+
+//LogMode change the level of the wrapped logger
+func (l *tracingLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &tracingLogger{l.Interface.LogMode(level)}
+}
+
+//Trace emit the span and log the sql
+func (l *tracingLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if t := getTracer(); t != nil {
+		end := time.Now()
+		sql, rows := fc()
+		sql = redactSQL(sql)
+		operation, table := parseStatement(sql)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		t.Trace(ctx, &Span{
+			Operation: operation,
+			Table:     table,
+			SQL:       sql,
+			Rows:      rows,
+			Begin:     begin,
+			End:       end,
+			Err:       err,
+		})
+	}
+	l.Interface.Trace(ctx, begin, fc, err)
+}
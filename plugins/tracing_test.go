@@ -0,0 +1,35 @@
+package plugins
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/logger"
+)
+
+type fakeTracer struct {
+	spans []*Span
+}
+
+func (t *fakeTracer) Trace(ctx context.Context, span *Span) {
+	t.spans = append(t.spans, span)
+}
+
+func TestTracingLogger(t *testing.T) {
+	ft := &fakeTracer{}
+	SetTracer(ft)
+	defer SetTracer(nil)
+
+	l := &tracingLogger{logger.Default.LogMode(logger.Silent)}
+	l.Trace(context.Background(), time.Now(), func() (string, int64) {
+		return `SELECT * FROM "fake" WHERE name = 'c'`, 2
+	}, nil)
+
+	assert.Equal(t, 1, len(ft.spans), "should emit one span")
+	assert.Equal(t, "SELECT", ft.spans[0].Operation, "")
+	assert.Equal(t, "fake", ft.spans[0].Table, "")
+	assert.Equal(t, `SELECT * FROM "fake" WHERE name = ?`, ft.spans[0].SQL, "")
+	assert.Equal(t, int64(2), ft.spans[0].Rows, "")
+}
@@ -0,0 +1,255 @@
+package plugins
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+var isolationLevels = map[string]sql.IsolationLevel{
+	"":                 sql.LevelDefault,
+	"default":          sql.LevelDefault,
+	"read uncommitted": sql.LevelReadUncommitted,
+	"read committed":   sql.LevelReadCommitted,
+	"repeatable read":  sql.LevelRepeatableRead,
+	"serializable":     sql.LevelSerializable,
+}
+
+//TxOptions the options of the transaction, not allowed for the nested transactions
+type TxOptions struct {
+	// Isolation read uncommitted, read committed, repeatable read or serializable, empty for the default of the db
+	Isolation string
+	ReadOnly  bool
+	// MaxAttempts the max attempts of the body on the serialization failures or the deadlocks, 0 for the setting
+	MaxAttempts int
+}
+
+//Tx the transaction begun manually, it's a savepoint if begun in a transaction
+type Tx interface {
+	db.Database
+
+	Commit() error
+
+	Rollback() error
+}
+
+//Transactor run the transactions with the options, or begin them manually.
+//The transactions begun in a transaction are nested by the savepoints.
+type Transactor interface {
+	TransactionWith(opts TxOptions, body func(db.Database) error) error
+
+	TransactionWithContext(ctx context.Context, opts TxOptions, body func(db.Database) error) error
+
+	//Begin the Commit or Rollback of the returned Tx must be called
+	Begin(opts TxOptions) (Tx, error)
+
+	//BeginContext the tx is rolled back if the ctx is done, the default timeout is not applied
+	BeginContext(ctx context.Context, opts TxOptions) (Tx, error)
+}
+
+func (o TxOptions) sqlOptions() (*sql.TxOptions, error) {
+	level, ok := isolationLevels[strings.ToLower(strings.ReplaceAll(o.Isolation, "_", " "))]
+	if !ok {
+		return nil, Invalidf("INVALID_ISOLATION: %s", o.Isolation)
+	}
+	return &sql.TxOptions{
+		Isolation: level,
+		ReadOnly:  o.ReadOnly,
+	}, nil
+}
+
+//ormTx the transaction or the savepoint
+type ormTx struct {
+	*ormImpl
+	// the savepoint of the nested transaction, empty for the top one
+	savepoint string
+	done      bool
+}
+
+func (t *ormTx) Commit() error {
+	if t.done {
+		return Invalidf("INVALID_TRANSACTION: committed or rolled back")
+	}
+	var err error
+	if t.savepoint != "" {
+		err = t.db.Exec("RELEASE SAVEPOINT " + t.savepoint).Error
+	} else {
+		err = t.db.Commit().Error
+	}
+	if err == nil {
+		t.done = true
+	}
+	return WrapError(err)
+}
+
+func (t *ormTx) Rollback() error {
+	if t.done {
+		return Invalidf("INVALID_TRANSACTION: committed or rolled back")
+	}
+	t.done = true
+	if t.savepoint != "" {
+		return WrapError(t.db.RollbackTo(t.savepoint).Error)
+	}
+	return WrapError(t.db.Rollback().Error)
+}
+
+//OK
+//Ex:
+// tx, err := dbclient.(plugins.Transactor).Begin(plugins.TxOptions{Isolation: "serializable"})
+// if err != nil {
+// 	return err
+// }
+// if err = tx.Create(q.BaseData, &one); err != nil {
+// 	tx.Rollback()
+// 	return err
+// }
+// err = tx.Commit()
+func (p *ormImpl) Begin(opts TxOptions) (Tx, error) {
+	if p.inTx {
+		if opts.Isolation != "" || opts.ReadOnly {
+			return nil, Invalidf("INVALID_TRANSACTION: the options of the nested transaction")
+		}
+		tx := p.session(p.db)
+		tx.depth++
+		name := fmt.Sprintf("sp_%d", tx.depth)
+		if err := p.db.SavePoint(name).Error; err != nil {
+			return nil, WrapError(err)
+		}
+		return &ormTx{ormImpl: tx, savepoint: name}, nil
+	}
+	sqlOptions, err := opts.sqlOptions()
+	if err != nil {
+		return nil, err
+	}
+	d := p.db.Begin(sqlOptions)
+	if d.Error != nil {
+		return nil, WrapError(d.Error)
+	}
+	tx := p.session(d)
+	tx.inTx = true
+	return &ormTx{ormImpl: tx}, nil
+}
+
+//OK
+//The tx is rolled back if the ctx is done, the default timeout is not applied
+//Ex:
+// tx, err := dbclient.(plugins.Transactor).BeginContext(ctx, plugins.TxOptions{})
+// if err != nil {
+// 	return err
+// }
+// defer tx.Rollback()
+// if err = tx.Updates(q.BaseData, db.CommonMap{"value": 101}, &rows); err != nil {
+// 	return err
+// }
+// err = tx.Commit()
+func (p *ormImpl) BeginContext(ctx context.Context, opts TxOptions) (Tx, error) {
+	return p.session(p.db.WithContext(ctx)).Begin(opts)
+}
+
+//OK
+//The body is rolled back on the error or the panic, it's a savepoint if run in a transaction.
+//The body is retried on the serialization failures or the deadlocks up to the max attempts,
+//it should have no side effects out of the tx.
+//Ex:
+// err = dbclient.(plugins.Transactor).TransactionWith(plugins.TxOptions{ReadOnly: true}, func(tx db.Database) error {
+// 	return tx.Find(q, &list)
+// })
+func (p *ormImpl) TransactionWith(opts TxOptions, body func(db.Database) error) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("transaction", noTableLabel, begin, err) }(time.Now())
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = p.maxAttempts
+	}
+	if p.inTx {
+		// the whole transaction is aborted, retry the top one
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		err = p.transaction(opts, body)
+		state, retryable := retryableState(err)
+		if !retryable || attempt >= attempts {
+			return
+		}
+		retryTotalVec.WithLabelValues(state).Inc()
+		if e := p.wait(p.backoff(attempt)); e != nil {
+			return
+		}
+	}
+}
+
+func (p *ormImpl) transaction(opts TxOptions, body func(db.Database) error) (err error) {
+	tx, err := p.Begin(opts)
+	if err != nil {
+		return
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			tx.Rollback()
+		}
+	}()
+	if err = body(tx); err == nil {
+		err = tx.Commit()
+	}
+	panicked = false
+	return
+}
+
+//OK
+//The default timeout bounds the whole transaction with the retries
+//Ex:
+// err = dbclient.(plugins.Transactor).TransactionWithContext(ctx, plugins.TxOptions{Isolation: "serializable"}, func(tx db.Database) error {
+// 	return tx.Create(q.BaseData, &one)
+// })
+func (p *ormImpl) TransactionWithContext(ctx context.Context, opts TxOptions, body func(db.Database) error) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.TransactionWith(opts, body)
+}
+
+//backoff the delay before the retry, doubled by the attempt with the jitter
+func (p *ormImpl) backoff(attempt int) time.Duration {
+	base := p.retryBackoff
+	if base <= 0 {
+		base = 20 * time.Millisecond
+	}
+	delay := base << uint(attempt-1)
+	return delay + time.Duration(rand.Int63n(int64(base)))
+}
+
+//wait the delay, or the ctx of the db is done
+func (p *ormImpl) wait(delay time.Duration) error {
+	ctx := p.db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+//retryableState check the err is a serialization failure(40001) or a deadlock(40P01)
+func retryableState(err error) (state string, ok bool) {
+	state = sqlState(err)
+	return state, state == "40001" || state == "40P01"
+}
+
+//sqlState get the SQLSTATE of the driver error, empty if none
+func sqlState(err error) string {
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) {
+		return e.SQLState()
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package plugins
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestTxOptions(t *testing.T) {
+	opts, err := TxOptions{Isolation: "Repeatable_Read", ReadOnly: true}.sqlOptions()
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}, opts, "")
+
+	_, err = TxOptions{Isolation: "snapshot"}.sqlOptions()
+	assert.NotNil(t, err, "should err on the unknown isolation")
+}
+
+func TestNestedTransaction(t *testing.T) {
+	impl := dryRunImpl(t)
+	impl.inTx = true
+
+	tx, err := impl.Begin(TxOptions{})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "sp_1", tx.(*ormTx).savepoint, "")
+	nested, err := tx.(*ormTx).Begin(TxOptions{})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, "sp_2", nested.(*ormTx).savepoint, "")
+	assert.Nil(t, nested.Rollback(), "should nil err")
+	assert.NotNil(t, nested.Commit(), "should err after the rollback")
+	assert.Nil(t, tx.Commit(), "should nil err")
+
+	_, err = impl.Begin(TxOptions{ReadOnly: true})
+	assert.NotNil(t, err, "should err on the options of the nested transaction")
+
+	fail := errors.New("fail")
+	err = impl.Transaction(func(tx db.Database) error {
+		return fail
+	})
+	assert.Equal(t, fail, err, "should return the err of the body")
+}
+
+type stateError string
+
+func (e stateError) Error() string {
+	return "state " + string(e)
+}
+
+func (e stateError) SQLState() string {
+	return string(e)
+}
+
+func TestRetryableState(t *testing.T) {
+	state, ok := retryableState(fmt.Errorf("wrapped: %w", stateError("40001")))
+	assert.True(t, ok, "serialization failure should be retried")
+	assert.Equal(t, "40001", state, "")
+	_, ok = retryableState(stateError("40P01"))
+	assert.True(t, ok, "deadlock should be retried")
+	_, ok = retryableState(stateError("23505"))
+	assert.False(t, ok, "unique violation should not be retried")
+	_, ok = retryableState(nil)
+	assert.False(t, ok, "")
+
+	impl := &ormImpl{retryBackoff: 10 * time.Millisecond}
+	assert.True(t, impl.backoff(3) >= 40*time.Millisecond, "should be doubled by the attempt")
+	assert.True(t, impl.backoff(3) < 50*time.Millisecond, "the jitter should be less than the base")
+}
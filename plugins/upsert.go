@@ -0,0 +1,201 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//UpsertOption the conflict columns and the columns to update on the conflict
+type UpsertOption struct {
+	// Conflict the columns of the unique constraint, required
+	Conflict []string
+	// Updates the columns updated on the conflict, all the inserted columns except the Conflict if empty
+	Updates []string
+}
+
+//Upserter insert the rows or update them on the conflict
+type Upserter interface {
+	//Upsert the entity could be a struct, a slice of structs, a map or a slice of maps
+	Upsert(q *db.BaseData, entity interface{}, option UpsertOption, rows *int64) error
+
+	UpsertContext(ctx context.Context, q *db.BaseData, entity interface{}, option UpsertOption, rows *int64) error
+}
+
+//OK
+//The maps should have the same keys, the soft-deleted rows are restored on the conflict
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake")
+// err = dbclient.(plugins.Upserter).Upsert(q.BaseData, []map[string]interface{}{
+// 	{"code": "a", "value": 1},
+// 	{"code": "b", "value": 2},
+// }, plugins.UpsertOption{Conflict: []string{"code"}}, &rows)
+func (p *ormImpl) Upsert(q *db.BaseData, entity interface{}, option UpsertOption, rows *int64) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("upsert", q.Table, begin, err) }(time.Now())
+	if len(option.Conflict) == 0 {
+		return Invalidf("INVALID_UPSERT: no conflict columns")
+	}
+	for _, columns := range [][]string{option.Conflict, option.Updates} {
+		for _, c := range columns {
+			if !IsColumn(c) {
+				return Invalidf("INVALID_UPSERT: %s", c)
+			}
+		}
+	}
+	var list []map[string]interface{}
+	switch entity.(type) {
+	case map[string]interface{}:
+		list = []map[string]interface{}{entity.(map[string]interface{})}
+	case *map[string]interface{}:
+		list = []map[string]interface{}{*entity.(*map[string]interface{})}
+	case []map[string]interface{}:
+		list = entity.([]map[string]interface{})
+	case *[]map[string]interface{}:
+		list = *entity.(*[]map[string]interface{})
+	case []interface{}:
+		//通过json转义过来的数组
+		for _, one := range entity.([]interface{}) {
+			m, ok := one.(map[string]interface{})
+			if !ok {
+				return ErrUnknownDataType
+			}
+			list = append(list, m)
+		}
+	default:
+		return p.upsertStruct(q, entity, option, rows)
+	}
+	if len(list) == 0 {
+		return
+	}
+	sql, params, err := p.upsertSQL(q.Table, list, option)
+	if err != nil {
+		return
+	}
+	d := p.db.Exec(sql, params...)
+	if err = d.Error; err != nil {
+		return
+	}
+	*rows = d.RowsAffected
+	return
+}
+
+func (p *ormImpl) UpsertContext(ctx context.Context, q *db.BaseData, entity interface{}, option UpsertOption, rows *int64) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.Upsert(q, entity, option, rows)
+}
+
+//upsertStruct upsert the structs by the gorm, the columns are the db names
+func (p *ormImpl) upsertStruct(q *db.BaseData, entity interface{}, option UpsertOption, rows *int64) error {
+	objType := reflect.TypeOf(entity)
+	for objType.Kind() == reflect.Ptr || objType.Kind() == reflect.Slice {
+		objType = objType.Elem()
+	}
+	if objType.Kind() != reflect.Struct {
+		return ErrUnknownDataType
+	}
+	conflict := clause.OnConflict{
+		Columns: make([]clause.Column, len(option.Conflict)),
+	}
+	for i, c := range option.Conflict {
+		conflict.Columns[i] = clause.Column{Name: c}
+	}
+	updates := option.Updates
+	if len(updates) == 0 {
+		// all the fields except the primary keys, the conflict columns and the created_at
+		stmt := &gorm.Statement{DB: p.db}
+		if err := stmt.Parse(entity); err != nil {
+			return err
+		}
+		for _, name := range stmt.Schema.DBNames {
+			if field := stmt.Schema.FieldsByDBName[name]; field.PrimaryKey || name == "created_at" ||
+				containsString(option.Conflict, name) {
+				continue
+			}
+			updates = append(updates, name)
+		}
+	}
+	conflict.DoUpdates = clause.AssignmentColumns(updates)
+	d := p.db.Table(q.Table).Clauses(conflict).Create(entity)
+	if d.Error != nil {
+		return d.Error
+	}
+	*rows = d.RowsAffected
+	return nil
+}
+
+//upsertSQL build the multi-row insert with the conflict clause of the engine
+func (p *ormImpl) upsertSQL(table string, list []map[string]interface{}, option UpsertOption) (sql string, params []interface{}, err error) {
+	tableOption := p.tableOption(table)
+	columns := make([]string, 0, len(list[0]))
+	for k := range list[0] {
+		if k == "created_at" || k == "updated_at" || k == "deleted_at" {
+			continue
+		}
+		if !IsColumn(k) {
+			return "", nil, Invalidf("INVALID_UPSERT: %s", k)
+		}
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+
+	updates := option.Updates
+	if len(updates) == 0 {
+		for _, c := range columns {
+			if !containsString(option.Conflict, c) {
+				updates = append(updates, c)
+			}
+		}
+	}
+	inserts := columns
+	if !tableOption.NoTimestamps {
+		inserts = append(append([]string{}, columns...), "created_at", "updated_at")
+		updates = append(append([]string{}, updates...), "updated_at")
+	}
+
+	now := time.Now()
+	values := make([]string, 0, len(list))
+	for _, row := range list {
+		if len(row) != len(list[0]) {
+			return "", nil, Invalidf("INVALID_UPSERT: the rows should have the same keys")
+		}
+		holders := make([]string, 0, len(inserts))
+		for _, c := range columns {
+			v, ok := row[c]
+			if !ok {
+				return "", nil, Invalidf("INVALID_UPSERT: the rows should have the same keys")
+			}
+			holders = append(holders, "?")
+			params = append(params, normalizeValue(v))
+		}
+		if !tableOption.NoTimestamps {
+			holders = append(holders, "?", "?")
+			params = append(params, now, now)
+		}
+		values = append(values, "("+strings.Join(holders, ",")+")")
+	}
+
+	sets := make([]string, 0, len(updates)+1)
+	for _, c := range updates {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", c, c))
+	}
+	if !tableOption.NoSoftDelete {
+		sets = append(sets, "deleted_at = NULL")
+	}
+	action := "DO NOTHING"
+	if len(sets) > 0 {
+		action = "DO UPDATE SET " + strings.Join(sets, ",")
+	}
+	sql = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (%s) %s",
+		table, strings.Join(inserts, ","), strings.Join(values, ","), strings.Join(option.Conflict, ","), action)
+	return
+}
+
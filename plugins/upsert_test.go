@@ -0,0 +1,29 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsertSQL(t *testing.T) {
+	list := []map[string]interface{}{
+		{"code": "a", "value": float64(1)},
+		{"code": "b", "value": float64(2)},
+	}
+	sql, params, err := dryRunImpl(t).upsertSQL("fake", list, UpsertOption{Conflict: []string{"code"}})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `INSERT INTO fake (code,value,created_at,updated_at) VALUES (?,?,?,?),(?,?,?,?) ON CONFLICT (code) DO UPDATE SET value = EXCLUDED.value,updated_at = EXCLUDED.updated_at,deleted_at = NULL`, sql, "")
+	assert.Equal(t, 8, len(params), "")
+	assert.Equal(t, int64(2), params[5], "")
+
+	RegisterTable("fake_tags", TableOption{NoSoftDelete: true, NoTimestamps: true})
+	sql, _, err = dryRunImpl(t).upsertSQL("fake_tags", []map[string]interface{}{{"fake_id": 1, "tag": "x"}},
+		UpsertOption{Conflict: []string{"fake_id", "tag"}})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, `INSERT INTO fake_tags (fake_id,tag) VALUES (?,?) ON CONFLICT (fake_id,tag) DO NOTHING`, sql, "")
+
+	list = append(list, map[string]interface{}{"code": "c"})
+	_, _, err = dryRunImpl(t).upsertSQL("fake", list, UpsertOption{Conflict: []string{"code"}})
+	assert.NotNil(t, err, "should err on the different keys")
+}
@@ -0,0 +1,11 @@
+package plugins
+
+import "math"
+
+//normalizeValue convert the float64 from the json to int64 if it's a int in the range of int64
+func normalizeValue(v interface{}) interface{} {
+	if f, ok := v.(float64); ok && f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+		return int64(f)
+	}
+	return v
+}
@@ -0,0 +1,15 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	assert.Equal(t, int64(2), normalizeValue(2.0), "")
+	assert.Equal(t, int64(-3), normalizeValue(-3.0), "")
+	assert.Equal(t, 2.0004, normalizeValue(2.0004), "should keep the small fraction")
+	assert.Equal(t, 1e19, normalizeValue(1e19), "should keep the float out of the int64")
+	assert.Equal(t, "1", normalizeValue("1"), "")
+}
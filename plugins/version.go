@@ -0,0 +1,104 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+//ConflictError the row changed since the version, returned by the UpdatesVersion
+type ConflictError struct {
+	Table   string
+	Version interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("VERSION_CONFLICT: %s changed since the version %v", e.Table, e.Version)
+}
+
+//VersionUpdater update the rows with the optimistic locking, the Version of the TableOption is required
+type VersionUpdater interface {
+	//UpdatesVersion update the rows matched the version, the next is the new version,
+	//*ConflictError returned if the rows changed, the rows is 0 if none matched the condition
+	UpdatesVersion(q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) error
+
+	UpdatesVersionContext(ctx context.Context, q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) error
+}
+
+//OK
+//The version of the updated_at is the time, or the epoch millis
+//Ex:
+// q := db.NewQuery()
+// q.SetTable("fake").SetCondition("id = ?", 1)
+// err = dbclient.(plugins.VersionUpdater).UpdatesVersion(q.BaseData, db.CommonMap{"value": 101}, 3, &rows, &next)
+// if _, ok := err.(*plugins.ConflictError); ok {
+// 	// reload and retry
+// }
+func (p *ormImpl) UpdatesVersion(q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) (err error) {
+	defer func(begin time.Time) { err = WrapError(err); observe("updates", q.Table, begin, err) }(time.Now())
+	column := p.tableOption(q.Table).Version
+	if column == "" {
+		return Invalidf("INVALID_VERSION: %s has no version column", q.Table)
+	}
+	if version == nil {
+		return Invalidf("INVALID_VERSION: version required")
+	}
+	version = normalizeValue(version)
+	if i, ok := version.(int); ok {
+		version = int64(i)
+	}
+	// the time in the db is in microseconds
+	now := time.Now().Truncate(time.Microsecond)
+	keyArr, params, err := p.updateSets(q.Table, updates, now)
+	if err != nil {
+		return
+	}
+
+	match := column + " = ?"
+	var nextVersion interface{}
+	switch v := version.(type) {
+	case int64:
+		if column == "updated_at" {
+			match = "floor(extract(epoch from updated_at) * 1000)::bigint = ?"
+			nextVersion = now.UnixNano() / int64(time.Millisecond)
+		} else {
+			nextVersion = v + 1
+		}
+	default:
+		if column != "updated_at" {
+			return Invalidf("INVALID_VERSION: %v", version)
+		}
+		nextVersion = now
+	}
+
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s and %s", q.Table, strings.Join(keyArr, ","),
+		p.scoped(q.Table, q.Condition, "deleted_at"), match)
+	params = append(params, q.Arguments...)
+	d := p.db.Exec(sql, append(params, version)...)
+	if err = d.Error; err != nil {
+		return
+	}
+	*rows = d.RowsAffected
+	if *rows > 0 {
+		*next = nextVersion
+		return
+	}
+	// none matched the version, check the rows exist
+	var total int64
+	if err = p.db.Table(q.Table).Where(p.scoped(q.Table, q.Condition, "deleted_at"), q.Arguments...).Count(&total).Error; err != nil {
+		return
+	}
+	if total > 0 {
+		return &ConflictError{Table: q.Table, Version: version}
+	}
+	return
+}
+
+func (p *ormImpl) UpdatesVersionContext(ctx context.Context, q *db.BaseData, updates db.CommonMap, version interface{}, rows *int64, next *interface{}) error {
+	tx, cancel := p.withTimeout(ctx)
+	defer cancel()
+	return tx.UpdatesVersion(q, updates, version, rows, next)
+}
@@ -0,0 +1,33 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/team4yf/yf-fpm-server-go/pkg/db"
+)
+
+func TestUpdatesVersion(t *testing.T) {
+	RegisterTable("fake_versions", TableOption{Version: "version"})
+	impl := dryRunImpl(t)
+	now := time.Now()
+	sets, params, err := impl.updateSets("fake_versions", db.CommonMap{"value": float64(101), "version": 9}, now)
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, []string{"updated_at=?", "version=version+1", "value = ?"}, sets, "")
+	assert.Equal(t, []interface{}{now, int64(101)}, params, "")
+
+	q := db.NewQuery()
+	q.SetTable("fake_versions").SetCondition("id = ?", 1)
+	var rows int64
+	var next interface{}
+	err = impl.UpdatesVersion(q.BaseData, db.CommonMap{"value": 101}, "a", &rows, &next)
+	assert.NotNil(t, err, "should err on the invalid version")
+
+	q.SetTable("fake")
+	err = impl.UpdatesVersion(q.BaseData, db.CommonMap{"value": 101}, 1, &rows, &next)
+	assert.NotNil(t, err, "should err without the version column")
+
+	err = &ConflictError{Table: "fake", Version: int64(3)}
+	assert.Equal(t, "VERSION_CONFLICT: fake changed since the version 3", err.Error(), "")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/team4yf/yf-fpm-server-go/fpm"
 	"github.com/team4yf/yf-fpm-server-go/pkg/db"
 
+	"github.com/team4yf/fpm-go-plugin-orm/plugins"
 	_ "github.com/team4yf/fpm-go-plugin-orm/plugins/pg"
 )
 
@@ -188,7 +189,7 @@ func TestFindBiz(t *testing.T) {
 		"skip":      -1,
 		"limit":     -1,
 		"sort":      "id-",
-	})
+	}, nil)
 
 	fmt.Printf("data: %v", data)
 	assert.Nil(t, err, "should not error")
@@ -203,7 +204,7 @@ func TestRemoveBiz(t *testing.T) {
 	data, err := app.Execute("common.remove", &fpm.BizParam{
 		"table": "fake",
 		"id":    107,
-	})
+	}, nil)
 
 	fmt.Printf("data: %v", data)
 	assert.Nil(t, err, "should not error")
@@ -218,7 +219,7 @@ func TestFirstBiz(t *testing.T) {
 	data, err := app.Execute("common.first", &fpm.BizParam{
 		"table":     "fake",
 		"condition": "name = 'c'",
-	})
+	}, nil)
 
 	fmt.Printf("data: %v", data)
 	assert.Nil(t, err, "should not error")
@@ -236,7 +237,7 @@ func TestCreateBiz(t *testing.T) {
 			"name":  "ff",
 			"value": 100,
 		},
-	})
+	}, nil)
 
 	fmt.Printf("data: %v", data)
 	assert.Nil(t, err, "should not error")
@@ -257,9 +258,37 @@ func TestUpdateBiz(t *testing.T) {
 			"createAt": time.Now().Unix(),
 			"value":    103,
 		},
-	})
+	}, nil)
 
 	fmt.Printf("data: %v", data)
 	assert.Nil(t, err, "should not error")
 
 }
+
+func TestEach(t *testing.T) {
+	app := fpm.New()
+
+	app.Init()
+
+	dbclient, exists := app.GetDatabase("pg")
+	assert.Equal(t, true, exists, "should true")
+
+	q := db.NewQuery()
+	q.SetTable("fake")
+	count := 0
+	err := dbclient.(plugins.Streamer).Each(q, func(row map[string]interface{}) error {
+		count++
+		return plugins.ErrStop
+	})
+	assert.Nil(t, err, "should nil err")
+	assert.Equal(t, true, count <= 1, "should stop at the first row")
+
+	list := make([]*Fake, 0)
+	err = dbclient.(plugins.Streamer).EachRow(q, func() interface{} {
+		return &Fake{}
+	}, func(one interface{}) error {
+		list = append(list, one.(*Fake))
+		return nil
+	})
+	assert.Nil(t, err, "should nil err")
+}